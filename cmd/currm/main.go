@@ -1,20 +1,114 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
 
+	"github.com/guchey/currm/pkg/cache"
 	"github.com/guchey/currm/pkg/config"
 	"github.com/guchey/currm/pkg/downloader"
+	"github.com/guchey/currm/pkg/httpclient"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
 )
 
 var (
 	configFile string
+	frozen     bool
+	offline    bool
+	prune      bool
+	keepGoing  bool
+	failFast   bool
+	jobs       int
+	hostJobs   int
+	// HTTP settings that override the configuration file
+	httpTimeout    time.Duration
+	requestTimeout time.Duration
+	retries        int
+	// pruneAge is the age after which stored rules are pruned
+	pruneAge time.Duration
+	// Settings of the rule added by the add command
+	addName        string
+	addRevision    string
+	addGlobs       string
+	addDescription string
+	addAlwaysApply bool
+	addInstall     bool
+	// failOn lists the rule states that make the check command exit with exitUpdatesAvailable
+	failOn []string
+	// outputFormat is the format commands print their results in: table, json or yaml
+	outputFormat string
 	// Version information
 	version = "0.1.0"
 )
 
+// Exit codes of the check command
+const (
+	exitUpdatesAvailable = 1
+	exitCheckError       = 2
+)
+
+// exitError makes a command exit with a specific code, printing err if it is set
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+// failOnCategories are the values accepted by --fail-on
+var failOnCategories = []string{"missing", "outdated", "modified"}
+
+// parseFailOn checks the values of --fail-on and returns them as a set
+func parseFailOn(values []string) (map[string]bool, error) {
+	categories := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		known := false
+		for _, category := range failOnCategories {
+			if value == category {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown value '%s' for --fail-on; use %s", value, strings.Join(failOnCategories, ", "))
+		}
+		categories[value] = true
+	}
+	return categories, nil
+}
+
+// failsCheck reports whether the status of a rule falls into one of the categories of --fail-on
+func failsCheck(status downloader.RuleStatus, categories map[string]bool) bool {
+	switch {
+	case categories["missing"] && status.State == downloader.StateNotInstalled:
+		return true
+	case categories["outdated"] && (status.IntegrityMismatch || status.State == downloader.StateUpstreamChanged ||
+		status.State == downloader.StateBothChanged || status.State == downloader.StateNewerCompatible):
+		return true
+	case categories["modified"] && (status.State == downloader.StateModifiedLocally || status.State == downloader.StateBothChanged):
+		return true
+	}
+	return false
+}
+
 // isLikelyCommitHash checks if a string looks like a commit hash
 func isLikelyCommitHash(s string) bool {
 	// Consider 40-character hexadecimal as SHA hash
@@ -40,27 +134,301 @@ func formatRevision(revision string) string {
 	return revision
 }
 
+// shortCommit shortens a commit hash for display
+func shortCommit(commit string) string {
+	if isLikelyCommitHash(commit) {
+		return commit[:8]
+	}
+	return commit
+}
+
+// formatStatusRevision describes the revision of a rule together with the commit it is installed at
+// and, if it moved, the commit it resolves to now
+func formatStatusRevision(status downloader.RuleStatus) string {
+	var parts []string
+	if status.Revision != "" {
+		parts = append(parts, formatRevision(status.Revision))
+	}
+
+	// Version ranges show the tag they resolve to
+	switch {
+	case status.InstalledTag != "" && status.UpstreamTag != "" && status.InstalledTag != status.UpstreamTag:
+		parts = append(parts, fmt.Sprintf("tag %s -> %s", status.InstalledTag, status.UpstreamTag))
+	case status.UpstreamTag != "":
+		parts = append(parts, fmt.Sprintf("tag %s", status.UpstreamTag))
+	}
+
+	commit := status.InstalledCommit
+	if commit == "" {
+		commit = status.UpstreamCommit
+	}
+	switch {
+	case commit == "":
+	case status.UpstreamCommit != "" && !strings.EqualFold(commit, status.UpstreamCommit):
+		parts = append(parts, fmt.Sprintf("commit %s -> %s", shortCommit(commit), shortCommit(status.UpstreamCommit)))
+	case !strings.EqualFold(commit, status.Revision):
+		// A revision that is already the commit is shown by formatRevision
+		parts = append(parts, fmt.Sprintf("commit %s", shortCommit(commit)))
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(" (%s)", strings.Join(parts, ", "))
+}
+
+// printCheckResults describes the status of every rule and what to do about it
+func printCheckResults(statuses []downloader.RuleStatus) {
+	updatesAvailable := false
+	integrityDrift := false
+	localChanges := false
+	newerMajor := false
+	checkFailed := false
+	fmt.Println("Checking for updates...")
+
+	for _, status := range statuses {
+		revInfo := formatStatusRevision(status)
+
+		if status.IntegrityMismatch {
+			fmt.Printf("- %s%s: Integrity mismatch (remote sha256 %s)\n", status.Name, revInfo, status.RemoteSHA256)
+			integrityDrift = true
+			continue
+		}
+
+		switch status.State {
+		case downloader.StateError:
+			fmt.Printf("- %s%s: Check failed: %s\n", status.Name, revInfo, status.Error)
+			checkFailed = true
+		case downloader.StateNotInstalled:
+			fmt.Printf("- %s%s: Rule is not installed\n", status.Name, revInfo)
+			updatesAvailable = true
+		case downloader.StateUpstreamChanged:
+			fmt.Printf("- %s%s: Update available\n", status.Name, revInfo)
+			updatesAvailable = true
+		case downloader.StateModifiedLocally:
+			fmt.Printf("- %s%s: Modified locally\n", status.Name, revInfo)
+			localChanges = true
+		case downloader.StateBothChanged:
+			fmt.Printf("- %s%s: Modified locally and changed upstream\n", status.Name, revInfo)
+			updatesAvailable = true
+			localChanges = true
+		case downloader.StateNewerCompatible:
+			fmt.Printf("- %s%s: Newer compatible version %s available\n", status.Name, revInfo, status.UpstreamTag)
+			updatesAvailable = true
+		case downloader.StateNewerMajor:
+			fmt.Printf("- %s%s: Up to date, newer major version %s available\n", status.Name, revInfo, status.NewerMajor)
+			newerMajor = true
+		default:
+			fmt.Printf("- %s%s: Up to date\n", status.Name, revInfo)
+		}
+	}
+
+	if localChanges {
+		fmt.Println("\nSome rules were modified locally; 'currm pull' overwrites local modifications")
+	}
+
+	if newerMajor {
+		fmt.Println("\nSome rules have newer versions outside their version range; change the revision in currm.yaml to move to them")
+	}
+
+	if integrityDrift {
+		fmt.Println("\nSome rules no longer match their pinned sha256; review the upstream changes before updating currm.yaml")
+	}
+
+	if updatesAvailable {
+		fmt.Println("\nRun 'currm pull' to install updates")
+	} else if !integrityDrift && !localChanges && !checkFailed {
+		fmt.Println("\nAll rules are up to date")
+	}
+}
+
+// writeOutput prints v as JSON or YAML, or calls table to print it as a table
+func writeOutput(format string, v interface{}, table func() error) error {
+	switch format {
+	case "table":
+		return table()
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("failed to encode JSON: %w", err)
+		}
+		return nil
+	case "yaml":
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(v); err != nil {
+			return fmt.Errorf("failed to encode YAML: %w", err)
+		}
+		return encoder.Close()
+	}
+	return fmt.Errorf("unknown output format '%s'; use table, json or yaml", format)
+}
+
+// ruleInfoStatus describes whether a listed rule is installed and who manages its file
+func ruleInfoStatus(info downloader.RuleInfo) string {
+	switch {
+	case info.File == "":
+		return "not installed"
+	case info.Orphaned:
+		return "orphaned"
+	case info.Managed:
+		return "managed"
+	}
+	return "unmanaged"
+}
+
+// printRuleTable prints the listed rules as a table
+func printRuleTable(infos []downloader.RuleInfo) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSOURCE\tREVISION\tCOMMIT\tSIZE\tGLOBS\tSTATUS")
+	for _, info := range infos {
+		revision := info.Revision
+		if info.ResolvedRevision != "" {
+			revision = fmt.Sprintf("%s (%s)", revision, info.ResolvedRevision)
+		}
+		size := "-"
+		if info.File != "" {
+			size = fmt.Sprintf("%d", info.Size)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			info.Name, orDash(string(info.Type)), orDash(info.Source), orDash(shortCommit(revision)),
+			orDash(shortCommit(info.ResolvedCommit)), size, orDash(info.Globs), ruleInfoStatus(info))
+	}
+	return w.Flush()
+}
+
+// orDash returns "-" for empty table cells
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// ruleFromSource creates a rule from the source given to the add command.
+// The source is a URL, a local file, or a GitHub shorthand such as owner/repo/path/to/rule.mdc@v1.
+// Local files are made relative to configDir, the directory of the configuration file.
+func ruleFromSource(source string, configDir string) (config.Rule, error) {
+	var rule config.Rule
+
+	if strings.Contains(source, "://") {
+		u, err := url.Parse(source)
+		if err != nil {
+			return rule, fmt.Errorf("invalid URL '%s': %w", source, err)
+		}
+		rule.URL = source
+		rule.Name = ruleNameFromPath(u.Path)
+		return rule, nil
+	}
+
+	// Anything that looks like a path or exists on disk is a local file
+	_, statErr := os.Stat(source)
+	if statErr == nil || filepath.IsAbs(source) || strings.HasPrefix(source, ".") {
+		rulePath := source
+		if !filepath.IsAbs(source) {
+			abs, err := filepath.Abs(source)
+			if err != nil {
+				return rule, fmt.Errorf("failed to resolve path '%s': %w", source, err)
+			}
+			absConfigDir, err := filepath.Abs(configDir)
+			if err != nil {
+				return rule, fmt.Errorf("failed to resolve path '%s': %w", configDir, err)
+			}
+			if rulePath, err = filepath.Rel(absConfigDir, abs); err != nil {
+				return rule, fmt.Errorf("failed to resolve path '%s': %w", source, err)
+			}
+		}
+		rule.Path = filepath.ToSlash(rulePath)
+		rule.Name = ruleNameFromPath(rule.Path)
+		return rule, nil
+	}
+
+	// owner/repo/path/to/rule.mdc with an optional @revision
+	shorthand, revision, _ := strings.Cut(source, "@")
+	segments := strings.Split(strings.Trim(shorthand, "/"), "/")
+	if len(segments) < 3 {
+		return rule, fmt.Errorf("cannot add '%s': expected a URL, a local file or owner/repo/path/to/rule.mdc", source)
+	}
+	rule.URL = fmt.Sprintf("https://github.com/%s/%s/blob/HEAD/%s", segments[0], segments[1], strings.Join(segments[2:], "/"))
+	rule.Revision = revision
+	rule.Name = ruleNameFromPath(shorthand)
+	return rule, nil
+}
+
+// ruleNameFromPath derives a rule name from the path of a rule file, such as "go" for rules/go.mdc.
+// A .cursorrules file is named after its directory.
+func ruleNameFromPath(p string) string {
+	p = strings.TrimSuffix(p, "/")
+	name := strings.TrimSuffix(path.Base(p), path.Ext(p))
+	if name == "" {
+		name = path.Base(path.Dir(p))
+	}
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+// applyHTTPFlags overrides the HTTP settings of the configuration with the flags that were set
+func applyHTTPFlags(cmd *cobra.Command, cfg *config.Config) {
+	if cmd.Flags().Changed("timeout") {
+		cfg.HTTP.Timeout = httpTimeout
+	}
+	if cmd.Flags().Changed("request-timeout") {
+		cfg.HTTP.RequestTimeout = requestTimeout
+	}
+	if cmd.Flags().Changed("retries") {
+		cfg.HTTP.Retries = &retries
+	}
+}
+
 func main() {
+	os.Exit(execute())
+}
+
+// execute runs the command given on the command line and returns the exit code
+func execute() int {
 	var rootCmd = &cobra.Command{
 		Use:   "currm",
 		Short: "Currm - A tool for downloading Cursor rules",
 		Long: `Currm is a tool for downloading Cursor rules defined in YAML files 
 to the .cursor/rules directory in your current directory.`,
 		Version: version,
+		// Errors are printed once by execute
+		SilenceErrors: true,
 	}
 
 	var pullCmd = &cobra.Command{
 		Use:   "pull",
 		Short: "Download rules specified in the configuration file",
+		Long: `Download rules specified in the configuration file.
+
+Rules are staged first and swapped in only when every rule succeeded; otherwise nothing
+is changed, a summary lists the failed rules and currm exits with status 1. Use --keep-going
+to install the rules that succeeded while still exiting with status 1, or --fail-fast to stop
+at the first failure. 'currm rollback' restores the rules replaced by the last install.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// Rules that fail are not a usage error
+			cmd.SilenceUsage = true
+
 			// Load configuration file
 			cfg, err := config.LoadConfig(configFile)
 			if err != nil {
 				return err
 			}
+			applyHTTPFlags(cmd, cfg)
 
 			// Download all rules
-			if err := downloader.DownloadAllRules(cfg); err != nil {
+			if err := downloader.DownloadAllRules(cfg, downloader.Options{
+				Frozen:      frozen,
+				Offline:     offline,
+				Prune:       prune,
+				KeepGoing:   keepGoing,
+				FailFast:    failFast,
+				Jobs:        jobs,
+				PerHostJobs: hostJobs,
+			}); err != nil {
 				return err
 			}
 
@@ -71,61 +439,357 @@ to the .cursor/rules directory in your current directory.`,
 	var checkCmd = &cobra.Command{
 		Use:   "check",
 		Short: "Check for updates to rules specified in the configuration file",
+		Long: `Check for updates to rules specified in the configuration file.
+
+Exit codes:
+  0  all rules are up to date
+  1  a rule is in a state listed by --fail-on, such as an available update
+  2  the check failed`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			// The exit code tells the outcome
+			cmd.SilenceUsage = true
+
+			categories, err := parseFailOn(failOn)
+			if err != nil {
+				return &exitError{code: exitCheckError, err: err}
+			}
+
 			// Load configuration file
 			cfg, err := config.LoadConfig(configFile)
 			if err != nil {
-				return err
+				return &exitError{code: exitCheckError, err: err}
 			}
+			applyHTTPFlags(cmd, cfg)
 
 			// Check for updates
-			statuses, err := downloader.CheckRuleUpdates(cfg)
+			statuses, err := downloader.CheckRuleUpdates(cfg, downloader.Options{
+				Jobs:        jobs,
+				PerHostJobs: hostJobs,
+			})
 			if err != nil {
-				return err
+				return &exitError{code: exitCheckError, err: err}
 			}
 
-			// Display results
-			updatesAvailable := false
-			fmt.Println("Checking for updates...")
+			err = writeOutput(outputFormat, statuses, func() error {
+				printCheckResults(statuses)
+				return nil
+			})
+			if err != nil {
+				return &exitError{code: exitCheckError, err: err}
+			}
 
+			// The statuses of the other rules are written first, so that scripts can still read them
+			var failed []string
 			for _, status := range statuses {
-				revInfo := ""
-				if status.Revision != "" {
-					revInfo = fmt.Sprintf(" (%s)", formatRevision(status.Revision))
+				if status.State == downloader.StateError {
+					failed = append(failed, status.Name)
+				}
+			}
+			if len(failed) > 0 {
+				return &exitError{code: exitCheckError, err: fmt.Errorf("%d of %d rule(s) could not be checked: %s", len(failed), len(statuses), strings.Join(failed, ", "))}
+			}
+
+			for _, status := range statuses {
+				if failsCheck(status, categories) {
+					return &exitError{code: exitUpdatesAvailable}
+				}
+			}
+			return nil
+		},
+	}
+
+	var addCmd = &cobra.Command{
+		Use:   "add <url|owner/repo/path[@revision]|file>",
+		Short: "Add a rule to the configuration file",
+		Long: `Add a rule to the configuration file. The rule is fetched first to make sure it can be installed,
+and the configuration file is edited in place so that its comments and formatting are kept.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Rules that cannot be fetched are not a usage error
+			cmd.SilenceUsage = true
+
+			// A missing configuration file is created
+			cfg, err := config.LoadConfig(configFile)
+			if errors.Is(err, fs.ErrNotExist) {
+				cfg = &config.Config{Path: configFile}
+			} else if err != nil {
+				return err
+			}
+
+			rule, err := ruleFromSource(args[0], filepath.Dir(configFile))
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("name") {
+				rule.Name = addName
+			}
+			if cmd.Flags().Changed("revision") {
+				rule.Revision = addRevision
+			}
+			rule.Globs = addGlobs
+			rule.Description = addDescription
+			rule.AlwaysApply = addAlwaysApply
+			if rule.Name == "" {
+				return fmt.Errorf("cannot derive a rule name from '%s'; set one with --name", args[0])
+			}
+			if err := config.ValidateRuleName(rule.Name); err != nil {
+				return fmt.Errorf("%w; choose another name with --name", err)
+			}
+
+			for _, existing := range cfg.Rules {
+				if existing.Name == rule.Name {
+					return fmt.Errorf("rule '%s' already exists in '%s'; choose another name with --name", rule.Name, configFile)
 				}
+			}
+
+			// Make sure the rule can be installed before it is written to the configuration
+			content, err := downloader.FetchRule(cfg, rule, downloader.Options{})
+			if err != nil {
+				return fmt.Errorf("failed to add rule '%s': %w", rule.Name, err)
+			}
+
+			if err := config.AddRule(configFile, rule); err != nil {
+				return err
+			}
+			fmt.Printf("Added rule '%s' (%d bytes) to '%s'\n", rule.Name, len(content), configFile)
 
-				if !status.HasLocalFile {
-					fmt.Printf("- %s%s: Rule is not installed\n", status.Name, revInfo)
-					updatesAvailable = true
-				} else if status.NeedsUpdate {
-					fmt.Printf("- %s%s: Update available\n", status.Name, revInfo)
-					updatesAvailable = true
-				} else {
-					fmt.Printf("- %s%s: Up to date\n", status.Name, revInfo)
+			if !addInstall {
+				return nil
+			}
+
+			// Other rules are left as they are, so that a broken one does not fail the new rule
+			cfg, err = config.LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+			return downloader.DownloadAllRules(cfg, downloader.Options{Rules: []string{rule.Name}})
+		},
+	}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List configured rules and the rule files in the rules directory",
+		Long: `List the rules of the configuration file together with their installed files, followed by rule files
+that currm does not manage. The type tells how Cursor applies a rule according to its front matter.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Errors such as an unknown output format are not a usage error
+			cmd.SilenceUsage = true
+
+			cfg, err := config.LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+
+			infos, err := downloader.ListRules(cfg)
+			if err != nil {
+				return err
+			}
+
+			return writeOutput(outputFormat, infos, func() error {
+				return printRuleTable(infos)
+			})
+		},
+	}
+
+	var removeCmd = &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a rule from the configuration file and delete its installed files",
+		Long: `Remove a rule from the configuration file and delete the files currm installed for it.
+Files that were modified since they were installed are kept.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// An unknown rule is not a usage error
+			cmd.SilenceUsage = true
+
+			cfg, err := config.LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+
+			if err := config.RemoveRule(configFile, args[0]); err != nil {
+				return err
+			}
+			fmt.Printf("Removed rule '%s' from '%s'\n", args[0], configFile)
+
+			return downloader.RemoveRule(cfg, args[0])
+		},
+	}
+
+	var validateCmd = &cobra.Command{
+		Use:   "validate",
+		Short: "Check the configuration file for mistakes",
+		Long: `Check the configuration file for unknown keys, duplicate or unsafe rule names, missing or
+conflicting sources, unsupported URL schemes and invalid revisions. Every problem is reported
+with its line and column, and currm exits with status 1 if there is any.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Problems of the configuration are not a usage error
+			cmd.SilenceUsage = true
+
+			cfg, err := config.LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Configuration file '%s' is valid (%d rules)\n", configFile, len(cfg.Rules))
+			return nil
+		},
+	}
+
+	var rollbackCmd = &cobra.Command{
+		Use:   "rollback",
+		Short: "Restore the rules and the lockfile replaced by the last install",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// A missing backup is not a usage error
+			cmd.SilenceUsage = true
+
+			cfg, err := config.LoadConfig(configFile)
+			if err != nil {
+				return err
+			}
+
+			return downloader.Rollback(cfg)
+		},
+	}
+
+	var cacheCmd = &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the local store of fetched rules",
+	}
+
+	var cacheListCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the rules in the store",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Errors of the store are not a usage error
+			cmd.SilenceUsage = true
+
+			store, err := cache.Open()
+			if err != nil {
+				return err
+			}
+
+			entries, err := store.Entries()
+			if err != nil {
+				return err
+			}
+			size, err := store.Size()
+			if err != nil {
+				return err
+			}
+
+			for _, entry := range entries {
+				source := entry.URL
+				if entry.Revision != "" {
+					source = fmt.Sprintf("%s (%s)", source, formatRevision(entry.Revision))
 				}
+				fmt.Printf("%s  %8d  %s  %s\n", entry.SHA256[:12], entry.Size, entry.FetchedAt.Local().Format(time.DateTime), source)
 			}
+			fmt.Printf("\n%d entries, %d bytes in '%s'\n", len(entries), size, store.Dir())
+			return nil
+		},
+	}
+
+	var cachePruneCmd = &cobra.Command{
+		Use:   "prune",
+		Short: "Remove rules fetched before a cutoff and unreferenced content",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Errors of the store are not a usage error
+			cmd.SilenceUsage = true
 
-			if updatesAvailable {
-				fmt.Println("\nRun 'currm pull' to install updates")
-			} else {
-				fmt.Println("\nAll rules are up to date")
+			store, err := cache.Open()
+			if err != nil {
+				return err
 			}
 
+			result, err := store.Prune(time.Now().Add(-pruneAge))
+			if err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed %d entries and %d objects, freed %d bytes\n", result.Entries, result.Objects, result.FreedBytes)
+			return nil
+		},
+	}
+
+	var cacheCleanCmd = &cobra.Command{
+		Use:   "clean",
+		Short: "Remove everything from the cache",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// Errors of the store are not a usage error
+			cmd.SilenceUsage = true
+
+			store, err := cache.Open()
+			if err != nil {
+				return err
+			}
+
+			if err := store.Clean(); err != nil {
+				return err
+			}
+
+			fmt.Printf("Removed '%s'\n", store.Dir())
 			return nil
 		},
 	}
 
 	// Set flags
 	pullCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	pullCmd.Flags().BoolVar(&frozen, "frozen", false, "Install exactly what currm.lock records and fail if it disagrees with the configuration")
+	pullCmd.Flags().BoolVar(&offline, "offline", false, "Install rules from the local store without using the network")
+	pullCmd.Flags().BoolVar(&keepGoing, "keep-going", false, "Install every rule that can be installed even if some rules fail")
+	pullCmd.Flags().BoolVar(&failFast, "fail-fast", false, "Stop installing rules after the first failure")
+	pullCmd.MarkFlagsMutuallyExclusive("keep-going", "fail-fast")
+	pullCmd.Flags().BoolVar(&prune, "prune", false, "Delete files installed for rules that were removed or whose revision changed")
+	cachePruneCmd.Flags().DurationVar(&pruneAge, "older-than", 30*24*time.Hour, "Remove rules fetched longer ago than this")
 	checkCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	checkCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json or yaml")
+	checkCmd.Flags().StringSliceVar(&failOn, "fail-on", []string{"missing", "outdated"}, "Rule states that make the check exit with status 1: missing, outdated, modified")
+	// Wrong flags are errors of the check, not rules that need attention
+	checkCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return &exitError{code: exitCheckError, err: err}
+	})
+	addCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	listCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	listCmd.Flags().StringVarP(&outputFormat, "output", "o", "table", "Output format: table, json or yaml")
+	removeCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	validateCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	rollbackCmd.Flags().StringVarP(&configFile, "config", "c", "currm.yaml", "Path to configuration file")
+	addCmd.Flags().StringVar(&addName, "name", "", "Name of the rule (derived from the file name by default)")
+	addCmd.Flags().StringVar(&addRevision, "revision", "", "Branch, tag, commit or version range to fetch")
+	addCmd.Flags().StringVar(&addGlobs, "globs", "", "Glob patterns of the files the rule applies to")
+	addCmd.Flags().StringVar(&addDescription, "description", "", "Description of the rule")
+	addCmd.Flags().BoolVar(&addAlwaysApply, "always-apply", false, "Always apply the rule")
+	addCmd.Flags().BoolVar(&addInstall, "install", false, "Install the added rule after adding it")
+	for _, cmd := range []*cobra.Command{pullCmd, checkCmd} {
+		cmd.Flags().IntVarP(&jobs, "jobs", "j", 0, "Number of rules processed at once (overrides 'concurrency' in the configuration)")
+		cmd.Flags().IntVar(&hostJobs, "jobs-per-host", 0, "Maximum number of concurrent requests per host (overrides 'perHostConcurrency' in the configuration)")
+		cmd.Flags().DurationVar(&httpTimeout, "timeout", httpclient.DefaultTimeout, "Total time allowed for fetching a rule, including retries")
+		cmd.Flags().DurationVar(&requestTimeout, "request-timeout", httpclient.DefaultRequestTimeout, "Time allowed for a single HTTP attempt")
+		cmd.Flags().IntVar(&retries, "retries", httpclient.DefaultRetries, "Number of retries for transient HTTP failures")
+	}
 
 	// Add commands
 	rootCmd.AddCommand(pullCmd)
 	rootCmd.AddCommand(checkCmd)
+	rootCmd.AddCommand(addCmd)
+	rootCmd.AddCommand(removeCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(rollbackCmd)
+	rootCmd.AddCommand(validateCmd)
+	cacheCmd.AddCommand(cacheListCmd, cachePruneCmd, cacheCleanCmd)
+	rootCmd.AddCommand(cacheCmd)
 
 	// Execute command
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		var exit *exitError
+		if errors.As(err, &exit) {
+			if exit.err != nil {
+				fmt.Fprintln(os.Stderr, exit.err)
+			}
+			return exit.code
+		}
+		fmt.Fprintln(os.Stderr, err)
+		return 1
 	}
+	return 0
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/downloader"
 	"github.com/spf13/cobra"
 )
 
@@ -20,7 +22,7 @@ func TestRootCommand(t *testing.T) {
 
 	// Execute the command
 	os.Args = []string{"currm"}
-	main()
+	execute()
 
 	// Restore standard output and get captured output
 	w.Close()
@@ -76,7 +78,7 @@ func TestPullCommand(t *testing.T) {
 
 	// Execute the pull command (should fail because the URL doesn't exist)
 	os.Args = []string{"currm", "pull", "--config", configPath}
-	main()
+	code := execute()
 
 	// Restore standard output and standard error, and get captured output
 	wOut.Close()
@@ -97,6 +99,14 @@ func TestPullCommand(t *testing.T) {
 	if stdoutOutput == "" && stderrOutput == "" {
 		t.Error("Pull command output is empty")
 	}
+
+	// A rule that cannot be installed fails the command
+	if code != 1 {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d", 1, code)
+	}
+	if !strings.Contains(stdoutOutput, "test-rule") || !strings.Contains(stdoutOutput, "failed") {
+		t.Errorf("Summary does not list the failed rule. Actual: %s", stdoutOutput)
+	}
 }
 
 func TestInvalidConfigFile(t *testing.T) {
@@ -166,3 +176,527 @@ to the .cursor/rules directory in your current directory.`,
 		t.Errorf("Error message does not include content related to the configuration file: %s", errorMsg)
 	}
 }
+
+func TestFormatStatusRevision(t *testing.T) {
+	first := "1111111111111111111111111111111111111111"
+	second := "2222222222222222222222222222222222222222"
+
+	tests := []struct {
+		name     string
+		status   downloader.RuleStatus
+		expected string
+	}{
+		{name: "no revision", status: downloader.RuleStatus{}, expected: ""},
+		{name: "tag", status: downloader.RuleStatus{Revision: "v1.0.0"}, expected: " (v1.0.0)"},
+		{name: "latest resolved", status: downloader.RuleStatus{Revision: "latest", InstalledCommit: first, UpstreamCommit: first}, expected: " (Latest version, commit 11111111)"},
+		{name: "branch moved", status: downloader.RuleStatus{InstalledCommit: first, UpstreamCommit: second}, expected: " (commit 11111111 -> 22222222)"},
+		{name: "not installed", status: downloader.RuleStatus{Revision: "main", UpstreamCommit: second}, expected: " (main, commit 22222222)"},
+		{name: "pinned commit", status: downloader.RuleStatus{Revision: first, InstalledCommit: first, UpstreamCommit: first}, expected: " (Commit: 11111111)"},
+		{name: "version range", status: downloader.RuleStatus{Revision: "^1.2", InstalledTag: "v1.2.0", UpstreamTag: "v1.2.0"}, expected: " (^1.2, tag v1.2.0)"},
+		{name: "version range moved", status: downloader.RuleStatus{Revision: "^1.2", InstalledTag: "v1.2.0", UpstreamTag: "v1.3.0"}, expected: " (^1.2, tag v1.2.0 -> v1.3.0)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := formatStatusRevision(tt.status); actual != tt.expected {
+				t.Errorf("Formatted revision does not match. Expected: %q, Actual: %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRuleFromSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		source   string
+		expected config.Rule
+		wantErr  bool
+	}{
+		{name: "URL", source: "https://example.com/rules/go.mdc", expected: config.Rule{Name: "go", URL: "https://example.com/rules/go.mdc"}},
+		{name: "cursorrules URL", source: "https://example.com/python/.cursorrules", expected: config.Rule{Name: "python", URL: "https://example.com/python/.cursorrules"}},
+		{name: "shorthand", source: "owner/repo/rules/go.mdc", expected: config.Rule{Name: "go", URL: "https://github.com/owner/repo/blob/HEAD/rules/go.mdc"}},
+		{name: "shorthand with revision", source: "owner/repo/go.mdc@v1.2.0", expected: config.Rule{Name: "go", URL: "https://github.com/owner/repo/blob/HEAD/go.mdc", Revision: "v1.2.0"}},
+		{name: "local file", source: "./rules/team.mdc", expected: config.Rule{Name: "team", Path: "rules/team.mdc"}},
+		{name: "too short", source: "owner/repo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ruleFromSource(tt.source, ".")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error for '%s'", tt.source)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ruleFromSource returned an error: %v", err)
+			}
+			if rule != tt.expected {
+				t.Errorf("Rule does not match. Expected: %+v, Actual: %+v", tt.expected, rule)
+			}
+		})
+	}
+}
+
+func TestAddCommand(t *testing.T) {
+	// Save the current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cmd-add-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to the temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to the original directory after the test
+	defer os.Chdir(originalDir)
+
+	if err := os.MkdirAll("rules", 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join("rules", "team.mdc"), []byte("Team rule"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	// A broken rule that is already configured does not fail the new one
+	configContent := "# Shared rules\nrules:\n  - name: broken\n    path: rules/missing.mdc\n"
+	if err := os.WriteFile("currm.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+
+	// Prepare to capture standard output
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	os.Args = []string{"currm", "add", "./rules/team.mdc", "--globs", "*.go", "--install"}
+	code := execute()
+	// A rule that cannot be fetched is an error without the usage
+	os.Args = []string{"currm", "add", "./rules/other.mdc"}
+	failedCode := execute()
+
+	w.Close()
+	os.Stdout = oldStdout
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	data, err := os.ReadFile("currm.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read configuration file: %v", err)
+	}
+	expected := "# Shared rules\nrules:\n  - name: broken\n    path: rules/missing.mdc\n  - name: team\n    path: rules/team.mdc\n    globs: '*.go'\n"
+	if string(data) != expected {
+		t.Errorf("Configuration file differs from expected. Expected: %q, Actual: %q", expected, string(data))
+	}
+
+	content, err := os.ReadFile(filepath.Join(".cursor", "rules", "team.mdc"))
+	if err != nil {
+		t.Fatalf("Added rule was not installed: %v\n%s", err, buf.String())
+	}
+	if string(content) != "Team rule" {
+		t.Errorf("Installed rule differs from expected. Expected: %s, Actual: %s", "Team rule", string(content))
+	}
+	if code != 0 {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", 0, code, buf.String())
+	}
+	if failedCode != 1 || strings.Contains(buf.String(), "Usage:") {
+		t.Errorf("Failed add exited with %d or printed the usage\n%s", failedCode, buf.String())
+	}
+}
+
+func TestRemoveCommand(t *testing.T) {
+	// Save the current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cmd-remove-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to the temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to the original directory after the test
+	defer os.Chdir(originalDir)
+
+	for _, name := range []string{"go.mdc", "python.mdc"} {
+		if err := os.WriteFile(name, []byte("Rule "+name), 0644); err != nil {
+			t.Fatalf("Failed to write rule file: %v", err)
+		}
+	}
+	configContent := "rules:\n  # Go style\n  - name: go\n    path: go.mdc\n  - name: python\n    path: python.mdc\n"
+	if err := os.WriteFile("currm.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+
+	// Prepare to capture standard output and standard error
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stdout, os.Stderr = w, w
+
+	os.Args = []string{"currm", "pull"}
+	execute()
+	os.Args = []string{"currm", "remove", "go"}
+	execute()
+	// An unknown rule is an error without the usage
+	os.Args = []string{"currm", "remove", "nope"}
+	failedCode := execute()
+
+	w.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	if failedCode != 1 || strings.Contains(buf.String(), "Usage:") {
+		t.Errorf("Removing an unknown rule exited with %d or printed the usage\n%s", failedCode, buf.String())
+	}
+
+	data, err := os.ReadFile("currm.yaml")
+	if err != nil {
+		t.Fatalf("Failed to read configuration file: %v", err)
+	}
+	expected := "rules:\n  - name: python\n    path: python.mdc\n"
+	if string(data) != expected {
+		t.Errorf("Configuration file differs from expected. Expected: %q, Actual: %q", expected, string(data))
+	}
+
+	if _, err := os.Stat(filepath.Join(".cursor", "rules", "go.mdc")); err == nil {
+		t.Errorf("Installed file of the removed rule was not deleted\n%s", buf.String())
+	}
+	if _, err := os.Stat(filepath.Join(".cursor", "rules", "python.mdc")); err != nil {
+		t.Errorf("Installed file of the remaining rule was deleted: %v", err)
+	}
+}
+
+func TestListCommand(t *testing.T) {
+	// Save the current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cmd-list-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to the temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to the original directory after the test
+	defer os.Chdir(originalDir)
+
+	if err := os.WriteFile("go.mdc", []byte("---\nglobs: *.go\n---\nUse gofmt"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	if err := os.WriteFile("currm.yaml", []byte("rules:\n  - name: go\n    path: go.mdc\n"), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(".cursor", "rules"), 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(".cursor", "rules", "mine.mdc"), []byte("Mine"), 0644); err != nil {
+		t.Fatalf("Failed to write hand-written rule: %v", err)
+	}
+
+	// run executes currm with the arguments and returns what it printed
+	run := func(args ...string) string {
+		oldStdout, oldStderr := os.Stdout, os.Stderr
+		r, w, _ := os.Pipe()
+		os.Stdout, os.Stderr = w, w
+
+		os.Args = append([]string{"currm"}, args...)
+		execute()
+
+		w.Close()
+		os.Stdout, os.Stderr = oldStdout, oldStderr
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		return buf.String()
+	}
+
+	run("pull")
+
+	var infos []downloader.RuleInfo
+	output := run("list", "--output", "json")
+	if err := json.Unmarshal([]byte(output), &infos); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, output)
+	}
+	if len(infos) != 2 || infos[0].Name != "go" || !infos[0].Managed || infos[0].Type != downloader.RuleTypeAutoAttached ||
+		infos[1].Name != "mine" || infos[1].Managed || infos[1].Type != downloader.RuleTypeManual {
+		t.Errorf("Listed rules differ from expected. Actual: %+v", infos)
+	}
+
+	output = run("list")
+	for _, expected := range []string{"NAME", "auto-attached", "managed", "unmanaged"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Table does not contain '%s'. Actual: %s", expected, output)
+		}
+	}
+
+	// An unknown output format is an error without the usage
+	output = run("list", "--output", "xml")
+	if !strings.Contains(output, "xml") || strings.Contains(output, "Usage:") {
+		t.Errorf("Unknown output format was not reported without the usage. Actual: %s", output)
+	}
+}
+
+func TestCheckCommand(t *testing.T) {
+	// Save the current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cmd-check-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to the temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to the original directory after the test
+	defer os.Chdir(originalDir)
+
+	if err := os.WriteFile("go.mdc", []byte("Use gofmt"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	if err := os.WriteFile("currm.yaml", []byte("rules:\n  - name: go\n    path: go.mdc\n"), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+
+	// run executes currm with the arguments and returns the exit code and what it printed
+	run := func(args ...string) (int, string) {
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		os.Args = append([]string{"currm"}, args...)
+		code := execute()
+
+		w.Close()
+		os.Stdout = oldStdout
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		return code, buf.String()
+	}
+
+	// A rule that is not installed fails the check by default
+	if code, output := run("check"); code != exitUpdatesAvailable {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitUpdatesAvailable, code, output)
+	}
+	if code, output := run("check", "--fail-on", "modified"); code != 0 {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", 0, code, output)
+	}
+
+	run("pull")
+	code, output := run("check", "--output", "json")
+	if code != 0 {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", 0, code, output)
+	}
+	var statuses []downloader.RuleStatus
+	if err := json.Unmarshal([]byte(output), &statuses); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, output)
+	}
+	if len(statuses) != 1 || statuses[0].Name != "go" || statuses[0].State != downloader.StateUpToDate {
+		t.Errorf("Statuses differ from expected. Actual: %+v", statuses)
+	}
+
+	// Local edits only fail the check when asked to
+	if err := os.WriteFile(filepath.Join(".cursor", "rules", "go.mdc"), []byte("Edited by hand"), 0644); err != nil {
+		t.Fatalf("Failed to edit installed rule: %v", err)
+	}
+	if code, output := run("check"); code != 0 {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", 0, code, output)
+	}
+	code, output = run("check", "--fail-on", "missing,modified", "--output", "yaml")
+	if code != exitUpdatesAvailable {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitUpdatesAvailable, code, output)
+	}
+	if !strings.Contains(output, "state: modified-locally") {
+		t.Errorf("YAML output does not contain the state. Actual: %s", output)
+	}
+
+	// Errors have their own exit code
+	if code, output := run("check", "--fail-on", "typo"); code != exitCheckError {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitCheckError, code, output)
+	}
+	if code, output := run("check", "--config", "missing.yaml"); code != exitCheckError {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitCheckError, code, output)
+	}
+	if code, output := run("check", "--no-such-flag"); code != exitCheckError {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitCheckError, code, output)
+	}
+
+	// A rule that cannot be checked does not hide the others, and the output stays parseable
+	brokenConfig := "rules:\n  - name: go\n    path: go.mdc\n  - name: missing\n    path: missing.mdc\n"
+	if err := os.WriteFile("broken.yaml", []byte(brokenConfig), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+	code, output = run("check", "--config", "broken.yaml", "--output", "json")
+	if code != exitCheckError {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitCheckError, code, output)
+	}
+	statuses = nil
+	if err := json.Unmarshal([]byte(output), &statuses); err != nil {
+		t.Fatalf("Output is not JSON: %v\n%s", err, output)
+	}
+	if len(statuses) != 2 || statuses[0].State == downloader.StateError || statuses[1].State != downloader.StateError || statuses[1].Error == "" {
+		t.Errorf("Statuses differ from expected. Actual: %+v", statuses)
+	}
+
+	// A rule that cannot be checked is not reported as up to date
+	if err := os.WriteFile("missing-only.yaml", []byte("rules:\n  - name: missing\n    path: missing.mdc\n"), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+	code, output = run("check", "--config", "missing-only.yaml")
+	if code != exitCheckError {
+		t.Errorf("Exit code does not match. Expected: %d, Actual: %d\n%s", exitCheckError, code, output)
+	}
+	if !strings.Contains(output, "Check failed") || strings.Contains(output, "All rules are up to date") {
+		t.Errorf("Output contradicts the failed check. Actual: %s", output)
+	}
+}
+
+func TestRollbackCommand(t *testing.T) {
+	// Save the current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cmd-rollback-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to the temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to the original directory after the test
+	defer os.Chdir(originalDir)
+
+	configContent := "rules:\n  - name: go\n    path: go.mdc\n"
+	if err := os.WriteFile("currm.yaml", []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to create configuration file: %v", err)
+	}
+
+	// Prepare to capture standard output and standard error
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stdout, os.Stderr = w, w
+
+	for _, content := range []string{"Go rule v1", "Go rule v2"} {
+		if err := os.WriteFile("go.mdc", []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write rule file: %v", err)
+		}
+		os.Args = []string{"currm", "pull"}
+		execute()
+	}
+	os.Args = []string{"currm", "rollback"}
+	code := execute()
+	// The backup is used up; a second rollback is an error without the usage
+	failedCode := execute()
+
+	w.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	var buf bytes.Buffer
+	io.Copy(&buf, r)
+
+	if failedCode != 1 || strings.Contains(buf.String(), "Usage:") {
+		t.Errorf("Rollback without a backup exited with %d or printed the usage\n%s", failedCode, buf.String())
+	}
+
+	if code != 0 {
+		t.Fatalf("Rollback exited with code %d\n%s", code, buf.String())
+	}
+	data, err := os.ReadFile(filepath.Join(".cursor", "rules", "go.mdc"))
+	if err != nil {
+		t.Fatalf("Failed to read installed rule: %v", err)
+	}
+	if string(data) != "Go rule v1" {
+		t.Errorf("Rule was not rolled back. Expected: %s, Actual: %s", "Go rule v1", string(data))
+	}
+}
+
+func TestValidateCommand(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cmd-validate-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	testCases := []struct {
+		name     string
+		content  string
+		code     int
+		expected string
+	}{
+		{
+			name:     "valid configuration",
+			content:  "rules:\n  - name: go\n    url: https://example.com/go.mdc\n",
+			code:     0,
+			expected: "is valid (1 rules)",
+		},
+		{
+			name:     "invalid configuration",
+			content:  "rules:\n  - name: go\n    url: https://example.com/go.mdc\n    alwaysapply: true\n",
+			code:     1,
+			expected: "line 4, column 5: unknown field 'alwaysapply'",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, "currm.yaml")
+			if err := os.WriteFile(configPath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Failed to create configuration file: %v", err)
+			}
+
+			// Prepare to capture standard output and standard error together
+			oldStdout, oldStderr := os.Stdout, os.Stderr
+			r, w, _ := os.Pipe()
+			os.Stdout, os.Stderr = w, w
+
+			os.Args = []string{"currm", "validate", "-c", configPath}
+			code := execute()
+
+			w.Close()
+			os.Stdout, os.Stderr = oldStdout, oldStderr
+			var buf bytes.Buffer
+			io.Copy(&buf, r)
+
+			if code != tc.code {
+				t.Errorf("Exit code does not match. Expected: %d, Actual: %d", tc.code, code)
+			}
+			if !strings.Contains(buf.String(), tc.expected) {
+				t.Errorf("Output does not contain the expected message. Expected: %s, Actual: %s", tc.expected, buf.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// HostConfig holds the credentials configured for a single host in the user-level auth file
+type HostConfig struct {
+	Token    string            `yaml:"token,omitempty"`    // Sent as a bearer token
+	Username string            `yaml:"username,omitempty"` // Sent with Password as basic credentials
+	Password string            `yaml:"password,omitempty"`
+	Headers  map[string]string `yaml:"headers,omitempty"` // Additional headers sent to the host
+}
+
+// FileConfig represents the structure of the user-level auth file
+type FileConfig struct {
+	Hosts map[string]HostConfig `yaml:"hosts"`
+}
+
+// githubHosts are the hosts that receive GITHUB_TOKEN or GH_TOKEN
+var githubHosts = map[string]bool{
+	"github.com":                 true,
+	"api.github.com":             true,
+	"raw.githubusercontent.com":  true,
+	"gist.githubusercontent.com": true,
+}
+
+// Resolver finds the credentials to send to a host
+type Resolver struct {
+	hosts       map[string]HostConfig
+	githubToken string
+	netrc       *netrc
+
+	// Git is asked for credentials when a host answers 401 or 403; it is disabled when nil
+	Git *GitCredentials
+
+	// helperCredentials holds credentials from the git credential helper that were accepted by a host
+	mu                sync.Mutex
+	helperCredentials map[string]*GitCredential
+}
+
+// NewResolver creates a resolver from explicitly given host credentials
+func NewResolver(hosts map[string]HostConfig) *Resolver {
+	return &Resolver{hosts: hosts}
+}
+
+// UserConfigPath returns the path of the user-level auth file.
+// CURRM_AUTH_FILE overrides the default location in the user configuration directory.
+func UserConfigPath() (string, error) {
+	if path := os.Getenv("CURRM_AUTH_FILE"); path != "" {
+		return path, nil
+	}
+
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user configuration directory: %w", err)
+	}
+	return filepath.Join(configDir, "currm", "auth.yaml"), nil
+}
+
+// netrcPath returns the path of the netrc file, honoring the NETRC environment variable
+func netrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// Load creates a resolver from the environment, the user-level auth file, the netrc file
+// and the git credential helper. Setting CURRM_GIT_CREDENTIALS=0 disables the credential helper.
+func Load() (*Resolver, error) {
+	resolver := &Resolver{githubToken: os.Getenv("GITHUB_TOKEN")}
+	if os.Getenv("CURRM_GIT_CREDENTIALS") != "0" {
+		resolver.Git = &GitCredentials{}
+	}
+	if resolver.githubToken == "" {
+		resolver.githubToken = os.Getenv("GH_TOKEN")
+	}
+
+	path, err := UserConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read auth file: %w", err)
+	}
+	if err == nil {
+		var fileConfig FileConfig
+		if err := yaml.Unmarshal(data, &fileConfig); err != nil {
+			return nil, fmt.Errorf("failed to parse auth file '%s': %w", path, err)
+		}
+		resolver.hosts = fileConfig.Hosts
+	}
+
+	if path := netrcPath(); path != "" {
+		resolver.netrc, err = loadNetrc(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return resolver, nil
+}
+
+// ForHost returns the credentials for the host (optionally with a port), or nil if there are none.
+// Credentials from the git credential helper that a host accepted take precedence over the auth file,
+// which takes precedence over GITHUB_TOKEN/GH_TOKEN, which take precedence over netrc.
+func (r *Resolver) ForHost(host string) *HostConfig {
+	if r == nil {
+		return nil
+	}
+
+	r.mu.Lock()
+	credential := r.helperCredentials[host]
+	r.mu.Unlock()
+	if credential != nil {
+		return &HostConfig{Username: credential.Username, Password: credential.Password}
+	}
+
+	hostname := host
+	if u, err := url.Parse("//" + host); err == nil {
+		hostname = u.Hostname()
+	}
+
+	if hostConfig, ok := r.hosts[host]; ok {
+		return &hostConfig
+	}
+	if hostConfig, ok := r.hosts[hostname]; ok {
+		return &hostConfig
+	}
+	if r.githubToken != "" && githubHosts[hostname] {
+		return &HostConfig{Token: r.githubToken}
+	}
+	if entry := r.netrc.lookup(hostname); entry != nil {
+		return &HostConfig{Username: entry.login, Password: entry.password}
+	}
+	return nil
+}
+
+// Apply adds the credentials for the request's host to the request
+func (r *Resolver) Apply(req *http.Request) {
+	hostConfig := r.ForHost(req.URL.Host)
+	if hostConfig == nil {
+		return
+	}
+
+	for name, value := range hostConfig.Headers {
+		req.Header.Set(name, value)
+	}
+	if req.Header.Get("Authorization") != "" {
+		return
+	}
+	if hostConfig.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+hostConfig.Token)
+	} else if hostConfig.Username != "" || hostConfig.Password != "" {
+		req.SetBasicAuth(hostConfig.Username, hostConfig.Password)
+	}
+}
+
+// Transport adds credentials to every request based on the host it is sent to.
+// Since credentials are resolved per request, redirects to another host never carry them.
+type Transport struct {
+	Base     http.RoundTripper
+	Resolver *Resolver
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	// Leave the caller's request untouched so that its headers are not reused for redirects
+	authReq := req.Clone(req.Context())
+	t.Resolver.Apply(authReq)
+	resp, err := base.RoundTrip(authReq)
+	if err != nil || !isAuthChallenge(resp) || t.Resolver == nil || t.Resolver.Git == nil || !isReplayable(req) {
+		return resp, err
+	}
+
+	// The host refused the request; ask the git credential helper and try once more
+	credential, fillErr := t.Resolver.Git.Fill(req.URL)
+	if fillErr != nil || credential == nil {
+		return resp, err
+	}
+	resp.Body.Close()
+
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		if retryReq.Body, err = req.GetBody(); err != nil {
+			return nil, err
+		}
+	}
+	t.Resolver.Apply(retryReq)
+	retryReq.SetBasicAuth(credential.Username, credential.Password)
+	resp, err = base.RoundTrip(retryReq)
+	if err != nil {
+		return nil, err
+	}
+
+	if isAuthChallenge(resp) {
+		t.Resolver.Git.Reject(req.URL, credential)
+	} else if resp.StatusCode < 400 {
+		t.Resolver.Git.Approve(req.URL, credential)
+		t.Resolver.remember(req.URL.Host, credential)
+	}
+	return resp, nil
+}
+
+// remember keeps credentials from the git credential helper for later requests to the host
+func (r *Resolver) remember(host string, credential *GitCredential) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.helperCredentials == nil {
+		r.helperCredentials = make(map[string]*GitCredential)
+	}
+	r.helperCredentials[host] = credential
+}
+
+// isAuthChallenge reports whether the response asks for different credentials.
+// A 403 for an exhausted rate limit, as GitHub sends it, is not a challenge.
+func isAuthChallenge(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		return resp.Header.Get("X-RateLimit-Remaining") != "0" && resp.Header.Get("Retry-After") == ""
+	}
+	return false
+}
+
+// isReplayable reports whether the request can be sent a second time
+func isReplayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// Redact removes user information such as embedded tokens from a URL so that it can be shown or recorded
+func Redact(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = nil
+	return u.String()
+}
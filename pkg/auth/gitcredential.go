@@ -0,0 +1,98 @@
+package auth
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// GitCredentials asks the credential helpers configured for git using the git credential protocol
+type GitCredentials struct {
+	// Command is the git executable; "git" from PATH is used when it is empty
+	Command string
+}
+
+// GitCredential is a username and password returned by a credential helper
+type GitCredential struct {
+	Username string
+	Password string
+}
+
+// Fill asks the credential helpers for the credentials of the URL's host.
+// It returns nil when no helper has credentials for the host.
+func (g *GitCredentials) Fill(u *url.URL) (*GitCredential, error) {
+	output, err := g.run("fill", describe(u, nil))
+	if err != nil {
+		// git exits with an error when no helper answers and prompting is disabled
+		return nil, nil
+	}
+
+	credential := &GitCredential{}
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), "=")
+		if !found {
+			continue
+		}
+		switch key {
+		case "username":
+			credential.Username = value
+		case "password":
+			credential.Password = value
+		}
+	}
+	if credential.Username == "" && credential.Password == "" {
+		return nil, nil
+	}
+	return credential, nil
+}
+
+// Approve tells the credential helpers that the credentials worked so that they can be stored
+func (g *GitCredentials) Approve(u *url.URL, credential *GitCredential) error {
+	_, err := g.run("approve", describe(u, credential))
+	return err
+}
+
+// Reject tells the credential helpers that the credentials were refused so that they can be erased
+func (g *GitCredentials) Reject(u *url.URL, credential *GitCredential) error {
+	_, err := g.run("reject", describe(u, credential))
+	return err
+}
+
+// describe encodes the URL and credentials in the git credential input format
+func describe(u *url.URL, credential *GitCredential) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "protocol=%s\n", u.Scheme)
+	fmt.Fprintf(&buf, "host=%s\n", u.Host)
+	if credential != nil {
+		fmt.Fprintf(&buf, "username=%s\n", credential.Username)
+		fmt.Fprintf(&buf, "password=%s\n", credential.Password)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes()
+}
+
+// run executes a git credential action with the given input
+func (g *GitCredentials) run(action string, input []byte) ([]byte, error) {
+	command := g.Command
+	if command == "" {
+		command = "git"
+	}
+
+	cmd := exec.Command(command, "credential", action)
+	cmd.Stdin = bytes.NewReader(input)
+	// Never fall back to an interactive prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git credential %s failed: %w: %s", action, err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// fakeGitScript emulates 'git credential' by answering fill with fixed credentials
+// and appending every invocation and its input to a log file
+const fakeGitScript = `#!/bin/sh
+input=$(cat)
+printf '%s\n%s\n--\n' "$2" "$input" >> "$FAKE_GIT_LOG"
+if [ "$2" = "fill" ]; then
+  if [ -n "$FAKE_GIT_PASSWORD" ]; then
+    printf '%s\nusername=helper-user\npassword=%s\n' "$input" "$FAKE_GIT_PASSWORD"
+  else
+    echo "fatal: could not read Username: terminal prompts disabled" >&2
+    exit 128
+  fi
+fi
+`
+
+// newFakeGit writes the fake git script to a temporary directory and returns its path and log file
+func newFakeGit(t *testing.T) (string, string) {
+	if runtime.GOOS == "windows" {
+		t.Skip("The fake git credential helper requires a POSIX shell")
+	}
+
+	tempDir := t.TempDir()
+	scriptPath := filepath.Join(tempDir, "git")
+	if err := os.WriteFile(scriptPath, []byte(fakeGitScript), 0755); err != nil {
+		t.Fatalf("Failed to write fake git script: %v", err)
+	}
+	logPath := filepath.Join(tempDir, "git.log")
+	t.Setenv("FAKE_GIT_LOG", logPath)
+	return scriptPath, logPath
+}
+
+// readGitLog returns the actions recorded by the fake git script
+func readGitLog(t *testing.T, logPath string) string {
+	data, err := os.ReadFile(logPath)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("Failed to read git log: %v", err)
+	}
+	return string(data)
+}
+
+// newProtectedServer creates a server that only accepts the given basic credentials
+func newProtectedServer(username, password string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != username || pass != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("private rule"))
+	}))
+}
+
+func TestGitCredentialsApproved(t *testing.T) {
+	gitPath, logPath := newFakeGit(t)
+	t.Setenv("FAKE_GIT_PASSWORD", "correct")
+
+	server := newProtectedServer("helper-user", "correct")
+	defer server.Close()
+
+	resolver := NewResolver(nil)
+	resolver.Git = &GitCredentials{Command: gitPath}
+	client := &http.Client{Transport: &Transport{Resolver: resolver}}
+
+	resp, err := client.Get(server.URL + "/rule.mdc")
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status code differs from expected. Expected: %d, Actual: %d", http.StatusOK, resp.StatusCode)
+	}
+
+	log := readGitLog(t, logPath)
+	host := strings.TrimPrefix(server.URL, "http://")
+	if !strings.Contains(log, "fill\nprotocol=http\nhost="+host) {
+		t.Errorf("Credential helper was not asked for the host:\n%s", log)
+	}
+	if !strings.Contains(log, "approve\nprotocol=http\nhost="+host+"\nusername=helper-user\npassword=correct") {
+		t.Errorf("Accepted credentials were not approved:\n%s", log)
+	}
+
+	// Later requests to the same host reuse the accepted credentials without asking again
+	resp, err = client.Get(server.URL + "/other.mdc")
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	resp.Body.Close()
+	if strings.Count(readGitLog(t, logPath), "fill\n") != 1 {
+		t.Errorf("Credential helper was asked again for a known host:\n%s", readGitLog(t, logPath))
+	}
+}
+
+func TestGitCredentialsRejected(t *testing.T) {
+	gitPath, logPath := newFakeGit(t)
+	t.Setenv("FAKE_GIT_PASSWORD", "outdated")
+
+	server := newProtectedServer("helper-user", "correct")
+	defer server.Close()
+
+	resolver := NewResolver(nil)
+	resolver.Git = &GitCredentials{Command: gitPath}
+	client := &http.Client{Transport: &Transport{Resolver: resolver}}
+
+	resp, err := client.Get(server.URL + "/rule.mdc")
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("Status code differs from expected. Expected: %d, Actual: %d", http.StatusUnauthorized, resp.StatusCode)
+	}
+	log := readGitLog(t, logPath)
+	if !strings.Contains(log, "reject\n") || strings.Contains(log, "approve\n") {
+		t.Errorf("Refused credentials were not rejected:\n%s", log)
+	}
+}
+
+func TestGitCredentialsRateLimited(t *testing.T) {
+	gitPath, logPath := newFakeGit(t)
+	t.Setenv("FAKE_GIT_PASSWORD", "correct")
+
+	// Create HTTP test server that answers like GitHub when the rate limit is used up
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	resolver := NewResolver(nil)
+	resolver.Git = &GitCredentials{Command: gitPath}
+	client := &http.Client{Transport: &Transport{Resolver: resolver}}
+
+	resp, err := client.Get(server.URL + "/repos/owner/repo/commits/main")
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusForbidden {
+		t.Errorf("Status code differs from expected. Expected: %d, Actual: %d", http.StatusForbidden, resp.StatusCode)
+	}
+	if log := readGitLog(t, logPath); log != "" {
+		t.Errorf("Credential helper was asked because of a rate limit:\n%s", log)
+	}
+}
+
+func TestGitCredentialsUnavailable(t *testing.T) {
+	gitPath, _ := newFakeGit(t)
+	t.Setenv("FAKE_GIT_PASSWORD", "")
+
+	credential, err := (&GitCredentials{Command: gitPath}).Fill(&url.URL{Scheme: "https", Host: "example.com"})
+	if err != nil || credential != nil {
+		t.Errorf("Expected no credentials and no error, got: %+v, %v", credential, err)
+	}
+}
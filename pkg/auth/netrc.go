@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// netrcEntry holds the login and password of a netrc machine entry
+type netrcEntry struct {
+	login    string
+	password string
+}
+
+// netrc holds the parsed machine entries of a netrc file.
+// The default entry is ignored, since it would send its credentials to every host, including redirect targets.
+type netrc struct {
+	machines map[string]netrcEntry
+}
+
+// lookup returns the entry for the host, or nil if the file has no machine entry for it
+func (n *netrc) lookup(host string) *netrcEntry {
+	if n == nil {
+		return nil
+	}
+	if entry, ok := n.machines[host]; ok {
+		return &entry
+	}
+	return nil
+}
+
+// loadNetrc reads the netrc file at path; a missing file yields no entries
+func loadNetrc(path string) (*netrc, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read netrc file: %w", err)
+	}
+	defer file.Close()
+
+	parsed, err := parseNetrc(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse netrc file '%s': %w", path, err)
+	}
+	return parsed, nil
+}
+
+// parseNetrc parses the machine, default, login and password tokens of a netrc file
+func parseNetrc(r io.Reader) (*netrc, error) {
+	parsed := &netrc{machines: make(map[string]netrcEntry)}
+
+	// Collect the tokens, skipping comments and macro definitions which end at the next blank line
+	var tokens []string
+	inMacro := false
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if inMacro {
+			inMacro = line != ""
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, field := range strings.Fields(line) {
+			if field == "macdef" {
+				inMacro = true
+				break
+			}
+			tokens = append(tokens, field)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var current *netrcEntry
+	var machine string
+	isDefault := false
+	flush := func() {
+		if current != nil && !isDefault {
+			parsed.machines[machine] = *current
+		}
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		switch tokens[i] {
+		case "machine":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("missing machine name")
+			}
+			flush()
+			i++
+			machine, isDefault, current = tokens[i], false, &netrcEntry{}
+		case "default":
+			flush()
+			machine, isDefault, current = "", true, &netrcEntry{}
+		case "login", "password", "account":
+			if i+1 >= len(tokens) {
+				return nil, fmt.Errorf("missing value for '%s'", tokens[i])
+			}
+			if current == nil {
+				return nil, fmt.Errorf("'%s' appears before any machine", tokens[i])
+			}
+			switch tokens[i] {
+			case "login":
+				current.login = tokens[i+1]
+			case "password":
+				current.password = tokens[i+1]
+			}
+			i++
+		}
+	}
+	flush()
+
+	return parsed, nil
+}
@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseNetrc(t *testing.T) {
+	content := `# Credentials for private rule hosts
+machine gitlab.example.com
+  login alice
+  password s3cret
+
+macdef init
+machine ignored.example.com login nobody password nothing
+
+machine git.example.com login bob password hunter2
+default login anonymous password guest
+`
+	parsed, err := parseNetrc(strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("parseNetrc returned an error: %v", err)
+	}
+
+	testCases := []struct {
+		host             string
+		expectedLogin    string
+		expectedPassword string
+	}{
+		{"gitlab.example.com", "alice", "s3cret"},
+		{"git.example.com", "bob", "hunter2"},
+	}
+
+	for _, tc := range testCases {
+		entry := parsed.lookup(tc.host)
+		if entry == nil {
+			t.Errorf("No entry found for %s", tc.host)
+			continue
+		}
+		if entry.login != tc.expectedLogin || entry.password != tc.expectedPassword {
+			t.Errorf("Entry for %s does not match. Expected: %s/%s, Actual: %s/%s",
+				tc.host, tc.expectedLogin, tc.expectedPassword, entry.login, entry.password)
+		}
+	}
+
+	// The default entry is not used for other hosts
+	for _, host := range []string{"ignored.example.com", "other.example.com"} {
+		if entry := parsed.lookup(host); entry != nil {
+			t.Errorf("Entry found for %s: %s", host, entry.login)
+		}
+	}
+
+	// Test invalid content
+	for _, invalid := range []string{"machine", "login alice", "machine example.com login"} {
+		if _, err := parseNetrc(strings.NewReader(invalid)); err == nil {
+			t.Errorf("No error occurred for invalid netrc content: %s", invalid)
+		}
+	}
+}
+
+func TestLoadNetrcMissingFile(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "netrc-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	parsed, err := loadNetrc(filepath.Join(tempDir, ".netrc"))
+	if err != nil {
+		t.Fatalf("loadNetrc returned an error for a missing file: %v", err)
+	}
+	if parsed.lookup("example.com") != nil {
+		t.Error("A missing netrc file produced credentials")
+	}
+}
@@ -0,0 +1,108 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Dir returns the directory currm caches data in.
+// CURRM_CACHE_DIR overrides the default location in the user cache directory (XDG_CACHE_HOME on Linux).
+func Dir() (string, error) {
+	if dir := os.Getenv("CURRM_CACHE_DIR"); dir != "" {
+		return dir, nil
+	}
+
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user cache directory: %w", err)
+	}
+	return filepath.Join(cacheDir, "currm"), nil
+}
+
+// Validators holds the HTTP validators of the content that was last installed for a rule
+type Validators struct {
+	URL             string    `json:"url"`
+	ETag            string    `json:"etag,omitempty"`
+	LastModified    string    `json:"lastModified,omitempty"`
+	ContentSHA256   string    `json:"contentSha256"`   // SHA-256 of the fetched content
+	InstalledSHA256 string    `json:"installedSha256"` // SHA-256 of the file written to the rules directory
+	FetchedAt       time.Time `json:"fetchedAt"`
+}
+
+// Cache stores data in a cache directory
+type Cache struct {
+	dir string
+
+	// mu serializes updates of the store index within the process
+	mu sync.Mutex
+}
+
+// New returns a cache stored in the given directory
+func New(dir string) *Cache {
+	return &Cache{dir: dir}
+}
+
+// Open returns the cache stored in the default cache directory
+func Open() (*Cache, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	return New(dir), nil
+}
+
+// validatorsPath returns the file the validators for the key are stored in
+func (c *Cache) validatorsPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, "http", hex.EncodeToString(sum[:])+".json")
+}
+
+// ValidatorsKey returns the key validators are stored under.
+// It includes the configuration file and rule name so that projects sharing a URL do not affect each other.
+func ValidatorsKey(configPath, ruleName, url string) string {
+	if abs, err := filepath.Abs(configPath); err == nil {
+		configPath = abs
+	}
+	return configPath + "\x00" + ruleName + "\x00" + url
+}
+
+// LoadValidators returns the validators stored under the key, or nil if there are none
+func (c *Cache) LoadValidators(key string) (*Validators, error) {
+	data, err := os.ReadFile(c.validatorsPath(key))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read cache entry: %w", err)
+	}
+
+	var validators Validators
+	if err := json.Unmarshal(data, &validators); err != nil {
+		// A corrupt entry only costs an unconditional request
+		return nil, nil
+	}
+	return &validators, nil
+}
+
+// SaveValidators stores the validators under the key
+func (c *Cache) SaveValidators(key string, validators Validators) error {
+	path := c.validatorsPath(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(validators, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDir(t *testing.T) {
+	t.Setenv("CURRM_CACHE_DIR", "/tmp/currm-cache")
+	dir, err := Dir()
+	if err != nil {
+		t.Fatalf("Dir returned an error: %v", err)
+	}
+	if dir != "/tmp/currm-cache" {
+		t.Errorf("CURRM_CACHE_DIR was not respected. Actual: %s", dir)
+	}
+
+	t.Setenv("CURRM_CACHE_DIR", "")
+	t.Setenv("XDG_CACHE_HOME", "/tmp/xdg-cache")
+	dir, err = Dir()
+	if err != nil {
+		t.Fatalf("Dir returned an error: %v", err)
+	}
+	if filepath.Base(dir) != "currm" {
+		t.Errorf("Cache directory is not named after currm. Actual: %s", dir)
+	}
+}
+
+func TestValidators(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "cache-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	c := New(tempDir)
+	key := ValidatorsKey("currm.yaml", "go", "https://example.com/go.mdc")
+
+	// Nothing is cached yet
+	validators, err := c.LoadValidators(key)
+	if err != nil || validators != nil {
+		t.Fatalf("Expected no validators and no error, got: %+v, %v", validators, err)
+	}
+
+	expected := Validators{
+		URL:             "https://example.com/go.mdc",
+		ETag:            `"abc"`,
+		LastModified:    "Mon, 02 Jan 2006 15:04:05 GMT",
+		ContentSHA256:   "content",
+		InstalledSHA256: "installed",
+		FetchedAt:       time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := c.SaveValidators(key, expected); err != nil {
+		t.Fatalf("SaveValidators returned an error: %v", err)
+	}
+
+	validators, err = c.LoadValidators(key)
+	if err != nil {
+		t.Fatalf("LoadValidators returned an error: %v", err)
+	}
+	if validators == nil || *validators != expected {
+		t.Errorf("Validators differ after round trip.\nExpected: %+v\nActual: %+v", expected, validators)
+	}
+
+	// The same URL used by another rule or project has its own entry
+	for _, other := range []string{
+		ValidatorsKey("currm.yaml", "other", "https://example.com/go.mdc"),
+		ValidatorsKey(filepath.Join("other", "currm.yaml"), "go", "https://example.com/go.mdc"),
+	} {
+		if validators, _ := c.LoadValidators(other); validators != nil {
+			t.Errorf("Validators leaked to another key: %+v", validators)
+		}
+	}
+}
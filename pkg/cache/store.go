@@ -0,0 +1,299 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// ErrNotCached is returned when the store has no content for a URL and revision
+var ErrNotCached = errors.New("not in the rule store")
+
+// StoreEntry describes a rule body in the store and the URL and revision it was fetched for
+type StoreEntry struct {
+	URL       string    `json:"url"`
+	Revision  string    `json:"revision,omitempty"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	// Commit is the commit the content was read from, if the source reported one
+	Commit string `json:"commit,omitempty"`
+}
+
+// storeIndex maps URL and revision to the content stored for them
+type storeIndex struct {
+	Entries map[string]StoreEntry `json:"entries"`
+}
+
+// storeKey returns the index key for a URL and revision
+func storeKey(url, revision string) string {
+	return url + "@" + revision
+}
+
+// objectPath returns the file the content with the given hash is stored in
+func (c *Cache) objectPath(digest string) string {
+	return filepath.Join(c.dir, "store", "objects", digest[:2], digest)
+}
+
+// indexPath returns the file the store index is kept in
+func (c *Cache) indexPath() string {
+	return filepath.Join(c.dir, "store", "index.json")
+}
+
+// loadIndex reads the store index; a missing index is empty
+func (c *Cache) loadIndex() (*storeIndex, error) {
+	index := &storeIndex{Entries: make(map[string]StoreEntry)}
+
+	data, err := os.ReadFile(c.indexPath())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read store index: %w", err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse store index: %w", err)
+	}
+	if index.Entries == nil {
+		index.Entries = make(map[string]StoreEntry)
+	}
+	return index, nil
+}
+
+// saveIndex replaces the store index atomically
+func (c *Cache) saveIndex(index *storeIndex) error {
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode store index: %w", err)
+	}
+	return writeFileAtomic(c.indexPath(), data)
+}
+
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write cache file: %w", err)
+	}
+	return nil
+}
+
+// Put adds the content fetched for the URL and revision to the store and returns its hash.
+// The commit is the one the revision resolved to, if known, so that offline installs can record it.
+func (c *Cache) Put(url, revision, commit string, content []byte, fetchedAt time.Time) (string, error) {
+	sum := sha256.Sum256(content)
+	digest := hex.EncodeToString(sum[:])
+
+	// Objects are immutable, so an existing object does not need to be written again
+	if _, err := os.Stat(c.objectPath(digest)); os.IsNotExist(err) {
+		if err := writeFileAtomic(c.objectPath(digest), content); err != nil {
+			return "", err
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index, err := c.loadIndex()
+	if err != nil {
+		return "", err
+	}
+	index.Entries[storeKey(url, revision)] = StoreEntry{
+		URL:       url,
+		Revision:  revision,
+		SHA256:    digest,
+		Size:      int64(len(content)),
+		FetchedAt: fetchedAt,
+		Commit:    commit,
+	}
+	if err := c.saveIndex(index); err != nil {
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// Get returns the content last stored for the URL and revision.
+// It returns ErrNotCached if the URL and revision were never fetched.
+func (c *Cache) Get(url, revision string) ([]byte, *StoreEntry, error) {
+	c.mu.Lock()
+	index, err := c.loadIndex()
+	c.mu.Unlock()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entry, ok := index.Entries[storeKey(url, revision)]
+	if !ok {
+		return nil, nil, ErrNotCached
+	}
+
+	content, err := c.Object(entry.SHA256)
+	if err != nil {
+		return nil, nil, err
+	}
+	return content, &entry, nil
+}
+
+// Object returns the stored content with the given hash after verifying it
+func (c *Cache) Object(digest string) ([]byte, error) {
+	if len(digest) != sha256.Size*2 {
+		return nil, fmt.Errorf("invalid object hash '%s'", digest)
+	}
+
+	content, err := os.ReadFile(c.objectPath(digest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrNotCached
+		}
+		return nil, fmt.Errorf("failed to read stored object: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("stored object %s is corrupt; run 'currm cache clean'", digest)
+	}
+	return content, nil
+}
+
+// Entries returns the store index sorted by URL and revision
+func (c *Cache) Entries() ([]StoreEntry, error) {
+	c.mu.Lock()
+	index, err := c.loadIndex()
+	c.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]StoreEntry, 0, len(index.Entries))
+	for _, entry := range index.Entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return storeKey(entries[i].URL, entries[i].Revision) < storeKey(entries[j].URL, entries[j].Revision)
+	})
+	return entries, nil
+}
+
+// PruneResult reports what Prune removed
+type PruneResult struct {
+	Entries    int
+	Objects    int
+	FreedBytes int64
+}
+
+// Prune removes index entries fetched before the cutoff and every object no entry refers to
+func (c *Cache) Prune(cutoff time.Time) (*PruneResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	index, err := c.loadIndex()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &PruneResult{}
+	referenced := make(map[string]bool)
+	for key, entry := range index.Entries {
+		if entry.FetchedAt.Before(cutoff) {
+			delete(index.Entries, key)
+			result.Entries++
+			continue
+		}
+		referenced[entry.SHA256] = true
+	}
+	if err := c.saveIndex(index); err != nil {
+		return nil, err
+	}
+
+	objectsDir := filepath.Join(c.dir, "store", "objects")
+	err = filepath.WalkDir(objectsDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || referenced[d.Name()] {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		result.Objects++
+		result.FreedBytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to prune rule store: %w", err)
+	}
+
+	return result, nil
+}
+
+// Size returns the number of bytes used by the stored objects
+func (c *Cache) Size() (int64, error) {
+	var size int64
+	err := filepath.WalkDir(filepath.Join(c.dir, "store", "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to measure rule store: %w", err)
+	}
+	return size, nil
+}
+
+// Clean removes everything in the cache directory, including the store and cached validators
+func (c *Cache) Clean() error {
+	if err := os.RemoveAll(c.dir); err != nil {
+		return fmt.Errorf("failed to clean cache: %w", err)
+	}
+	return nil
+}
+
+// Dir returns the directory the cache is stored in
+func (c *Cache) Dir() string {
+	return c.dir
+}
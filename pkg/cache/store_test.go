@@ -0,0 +1,115 @@
+package cache
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStorePutAndGet(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "store-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	c := New(tempDir)
+	fetchedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Nothing is stored yet
+	if _, _, err := c.Get("https://example.com/go.mdc", "v1"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached, got: %v", err)
+	}
+
+	digest, err := c.Put("https://example.com/go.mdc", "v1", "1a2b3c4d", []byte("go rules"), fetchedAt)
+	if err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+
+	content, entry, err := c.Get("https://example.com/go.mdc", "v1")
+	if err != nil {
+		t.Fatalf("Get returned an error: %v", err)
+	}
+	if string(content) != "go rules" {
+		t.Errorf("Stored content differs. Expected: %s, Actual: %s", "go rules", string(content))
+	}
+	if entry.SHA256 != digest || entry.Size != int64(len("go rules")) || !entry.FetchedAt.Equal(fetchedAt) || entry.Commit != "1a2b3c4d" {
+		t.Errorf("Store entry has unexpected fields: %+v", entry)
+	}
+
+	// The revision is part of the key
+	if _, _, err := c.Get("https://example.com/go.mdc", "v2"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached for another revision, got: %v", err)
+	}
+
+	// Identical content is stored once
+	if _, err := c.Put("https://mirror.example.com/go.mdc", "", "", []byte("go rules"), fetchedAt); err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+	entries, err := c.Entries()
+	if err != nil {
+		t.Fatalf("Entries returned an error: %v", err)
+	}
+	if len(entries) != 2 || entries[0].SHA256 != entries[1].SHA256 {
+		t.Errorf("Expected two entries sharing one object, got: %+v", entries)
+	}
+	size, err := c.Size()
+	if err != nil {
+		t.Fatalf("Size returned an error: %v", err)
+	}
+	if size != int64(len("go rules")) {
+		t.Errorf("Store size differs. Expected: %d, Actual: %d", len("go rules"), size)
+	}
+
+	// Corrupt objects are detected
+	if err := os.WriteFile(c.objectPath(digest), []byte("tampered"), 0644); err != nil {
+		t.Fatalf("Failed to corrupt object: %v", err)
+	}
+	if _, _, err := c.Get("https://example.com/go.mdc", "v1"); err == nil || errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected a corruption error, got: %v", err)
+	}
+}
+
+func TestStorePruneAndClean(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "store-prune-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	c := New(filepath.Join(tempDir, "cache"))
+	now := time.Now()
+
+	if _, err := c.Put("https://example.com/old.mdc", "", "", []byte("old"), now.Add(-48*time.Hour)); err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+	if _, err := c.Put("https://example.com/new.mdc", "", "", []byte("new"), now); err != nil {
+		t.Fatalf("Put returned an error: %v", err)
+	}
+
+	result, err := c.Prune(now.Add(-24 * time.Hour))
+	if err != nil {
+		t.Fatalf("Prune returned an error: %v", err)
+	}
+	if result.Entries != 1 || result.Objects != 1 || result.FreedBytes != int64(len("old")) {
+		t.Errorf("Prune result differs from expected: %+v", result)
+	}
+
+	if _, _, err := c.Get("https://example.com/old.mdc", ""); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Pruned entry is still available: %v", err)
+	}
+	if _, _, err := c.Get("https://example.com/new.mdc", ""); err != nil {
+		t.Errorf("Recent entry was pruned: %v", err)
+	}
+
+	if err := c.Clean(); err != nil {
+		t.Fatalf("Clean returned an error: %v", err)
+	}
+	if _, err := os.Stat(c.Dir()); !os.IsNotExist(err) {
+		t.Error("Cache directory still exists after Clean")
+	}
+}
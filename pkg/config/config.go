@@ -1,40 +1,117 @@
 package config
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sort"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
 
 // Rule represents information about a Cursor rule
 type Rule struct {
-	Name        string `yaml:"name"`
-	URL         string `yaml:"url"`
-	Revision    string `yaml:"revision,omitempty"`    // Specific revision or "latest"
-	Description string `yaml:"description,omitempty"` // Description for the rule
-	Globs       string `yaml:"globs,omitempty"`       // Glob patterns for file matching
-	AlwaysApply bool   `yaml:"alwaysApply,omitempty"` // Whether to always apply this rule
+	Name        string     `yaml:"name"`
+	URL         string     `yaml:"url,omitempty"`
+	Path        string     `yaml:"path,omitempty"`        // Local file, relative to the configuration file
+	Revision    string     `yaml:"revision,omitempty"`    // Specific revision, version range such as "^1.2", or "latest"
+	Description string     `yaml:"description,omitempty"` // Description for the rule
+	Globs       string     `yaml:"globs,omitempty"`       // Glob patterns for file matching
+	AlwaysApply bool       `yaml:"alwaysApply,omitempty"` // Whether to always apply this rule
+	SHA256      string     `yaml:"sha256,omitempty"`      // Expected SHA-256 of the fetched content
+	Git         *GitSource `yaml:"git,omitempty"`         // Rule file in a git repository
+	Dir         *DirSource `yaml:"dir,omitempty"`         // Directory of rule files to import
+
+	// From is the name of the dir rule this rule was imported from; it is not read from the configuration
+	From string `yaml:"-"`
+}
+
+// GitSource describes a rule file in a git repository
+type GitSource struct {
+	Repo string `yaml:"repo"`          // Repository URL that git can fetch from
+	Ref  string `yaml:"ref,omitempty"` // Branch, tag or commit; the default branch if empty
+	Path string `yaml:"path"`          // Path of the rule file in the repository
+}
+
+// DirSource describes a directory of a repository whose rule files are imported as separate rules.
+// Description, globs and alwaysApply of the rule are the front matter defaults of the imported files.
+type DirSource struct {
+	URL     string     `yaml:"url,omitempty"`     // GitHub URL of the directory, such as https://github.com/owner/repo/tree/main/rules
+	Git     *GitSource `yaml:"git,omitempty"`     // Directory in a git repository; path is the directory
+	Include []string   `yaml:"include,omitempty"` // Patterns of the files to import; every .mdc and .cursorrules file if empty
+	Exclude []string   `yaml:"exclude,omitempty"` // Patterns of the files to skip
+}
+
+// HTTPConfig configures timeouts and retries for fetching rules
+type HTTPConfig struct {
+	Timeout        time.Duration `yaml:"timeout,omitempty"`        // Total time allowed for a request including retries
+	RequestTimeout time.Duration `yaml:"requestTimeout,omitempty"` // Time allowed for a single attempt
+	Retries        *int          `yaml:"retries,omitempty"`        // Number of retries for transient failures
+	InitialBackoff time.Duration `yaml:"initialBackoff,omitempty"` // Delay before the first retry, doubled on every retry
+	MaxBackoff     time.Duration `yaml:"maxBackoff,omitempty"`     // Upper bound for the delay between retries
 }
 
 // Config represents the structure of the configuration file
 type Config struct {
 	Rules []Rule `yaml:"rules"`
+
+	// Concurrency is the number of rules downloaded or checked at once
+	Concurrency int `yaml:"concurrency,omitempty"`
+	// PerHostConcurrency limits how many requests are sent to the same host at once (0 means no limit)
+	PerHostConcurrency int `yaml:"perHostConcurrency,omitempty"`
+	// HTTP configures timeouts and retries
+	HTTP HTTPConfig `yaml:"http,omitempty"`
+	// GitHubAPIURL is the base URL of the GitHub API used to resolve refs to commits.
+	// It defaults to https://api.github.com for github.com and https://<host>/api/v3 for GitHub Enterprise hosts.
+	GitHubAPIURL string `yaml:"githubApiUrl,omitempty"`
+	// Providers lists the hosts of self-hosted git providers by provider: github, gitlab, bitbucket or gitea
+	Providers map[string][]string `yaml:"providers,omitempty"`
+
+	// Path is the location the configuration was loaded from
+	Path string `yaml:"-"`
 }
 
-// LoadConfig loads the configuration file from the specified path
+// LoadConfig loads the configuration file from the specified path.
+// Unknown keys and values the schema does not allow are reported together in a *ValidationError.
 func LoadConfig(path string) (*Config, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read configuration file: %w", err)
 	}
 
-	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	// The document keeps the positions problems are reported at
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
 		return nil, fmt.Errorf("failed to parse YAML: %w", err)
 	}
 
+	var config Config
+	var v validator
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+		// Decoding goes on after type errors, so the rest of the configuration is validated as well
+		var typeErr *yaml.TypeError
+		if !errors.As(err, &typeErr) {
+			return nil, fmt.Errorf("failed to parse YAML: %w", err)
+		}
+		v.addTypeErrors(&doc, typeErr)
+	}
+	config.Path = path
+
+	v.validate(&doc, &config)
+	if len(v.problems) > 0 {
+		sort.SliceStable(v.problems, func(i, j int) bool {
+			a, b := v.problems[i], v.problems[j]
+			return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+		})
+		return nil, &ValidationError{Path: path, Problems: v.problems}
+	}
+
 	return &config, nil
 }
 
@@ -0,0 +1,292 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// defaultIndent is the indentation used for configuration files that do not show their own
+const defaultIndent = 2
+
+// AddRule appends the rule to the configuration file at path, creating the file if it does not exist.
+// The file is edited as a YAML document, so comments, key order and quoting of the existing content are kept.
+func AddRule(path string, rule Rule) error {
+	if err := ValidateRuleName(rule.Name); err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+
+	rules, err := rulesNode(doc)
+	if err != nil {
+		return err
+	}
+	for _, item := range rules.Content {
+		if ruleName(item) == rule.Name {
+			return fmt.Errorf("rule '%s' already exists in '%s'", rule.Name, path)
+		}
+	}
+
+	// Encoding the document drops blank lines, so the rule is inserted into the text when the list is a block
+	if len(rules.Content) > 0 && rules.Style&yaml.FlowStyle == 0 {
+		edited, err := insertRule(data, doc, rules, rule)
+		if err != nil {
+			return err
+		}
+		return writeFile(path, edited)
+	}
+
+	var item yaml.Node
+	if err := item.Encode(rule); err != nil {
+		return fmt.Errorf("failed to encode rule '%s': %w", rule.Name, err)
+	}
+	rules.Content = append(rules.Content, &item)
+	// An empty flow sequence such as "rules: []" would keep the new rule on one line
+	rules.Style &^= yaml.FlowStyle
+
+	return writeDocument(path, doc, detectIndent(data))
+}
+
+// insertRule returns the configuration text with the rule appended to the block sequence of rules.
+// The rule is inserted after the last item, before the key that follows the rules, if any.
+func insertRule(data []byte, doc *yaml.Node, rules *yaml.Node, rule Rule) ([]byte, error) {
+	lines := splitLines(data)
+	dash, err := dashColumn(lines, rules)
+	if err != nil {
+		return nil, err
+	}
+	insertAt := sequenceEnd(lines, doc, rules, dash)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode([]Rule{rule}); err != nil {
+		return nil, fmt.Errorf("failed to encode rule '%s': %w", rule.Name, err)
+	}
+	encoder.Close()
+
+	var item []string
+	for _, line := range strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		item = append(item, strings.Repeat(" ", dash)+line)
+	}
+	item[len(item)-1] += "\n"
+
+	// The previous line may be the last line of a file without a final newline
+	if insertAt > 0 && !strings.HasSuffix(lines[insertAt-1], "\n") {
+		lines[insertAt-1] += "\n"
+	}
+
+	edited := append(append(append([]string{}, lines[:insertAt]...), item...), lines[insertAt:]...)
+	return []byte(strings.Join(edited, "")), nil
+}
+
+// RemoveRule removes the rule with the given name from the configuration file at path.
+// Like AddRule, it keeps comments and formatting of the rest of the file; comments directly above the rule are removed with it.
+func RemoveRule(path string, name string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read configuration file: %w", err)
+	}
+
+	doc, err := parseDocument(data)
+	if err != nil {
+		return err
+	}
+	rules, err := rulesNode(doc)
+	if err != nil {
+		return err
+	}
+
+	index := -1
+	for i, item := range rules.Content {
+		if ruleName(item) == name {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return fmt.Errorf("rule '%s' does not exist in '%s'", name, path)
+	}
+
+	if rules.Style&yaml.FlowStyle != 0 {
+		rules.Content = append(rules.Content[:index], rules.Content[index+1:]...)
+		return writeDocument(path, doc, detectIndent(data))
+	}
+
+	lines := splitLines(data)
+	dash, err := dashColumn(lines, rules)
+	if err != nil {
+		return err
+	}
+
+	// The rule spans from its comments to the comments of the next rule, or to the end of the rules
+	start := itemStart(lines, rules.Content[index], dash)
+	end := sequenceEnd(lines, doc, rules, dash)
+	if index+1 < len(rules.Content) {
+		end = itemStart(lines, rules.Content[index+1], dash)
+	}
+
+	edited := append(append([]string{}, lines[:start]...), lines[end:]...)
+	return writeFile(path, []byte(strings.Join(edited, "")))
+}
+
+// splitLines splits the file into lines that keep their line breaks
+func splitLines(data []byte) []string {
+	lines := strings.SplitAfter(string(data), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// dashColumn returns the column of the dashes that start the items of a block sequence
+func dashColumn(lines []string, rules *yaml.Node) (int, error) {
+	first := rules.Content[0]
+	dash := strings.LastIndex(lines[first.Line-1][:first.Column-1], "-")
+	if dash < 0 {
+		return 0, fmt.Errorf("failed to parse YAML: unexpected rule at line %d", first.Line)
+	}
+	return dash, nil
+}
+
+// itemStart returns the index of the first line of an item, including the comments directly above it
+func itemStart(lines []string, item *yaml.Node, dash int) int {
+	start := item.Line - 1
+	for start > 0 {
+		line := lines[start-1]
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if !strings.HasPrefix(strings.TrimSpace(line), "#") || indent != dash {
+			break
+		}
+		start--
+	}
+	return start
+}
+
+// sequenceEnd returns the index of the line after the last item of the rules,
+// leaving out blank lines and the comments of the key that follows
+func sequenceEnd(lines []string, doc *yaml.Node, rules *yaml.Node, dash int) int {
+	end := len(lines)
+	root := doc.Content[0]
+	for i := 1; i < len(root.Content); i += 2 {
+		if root.Content[i] == rules && i+1 < len(root.Content) {
+			end = root.Content[i+1].Line - 1
+		}
+	}
+	for end > 0 {
+		trimmed := strings.TrimSpace(lines[end-1])
+		indent := len(lines[end-1]) - len(strings.TrimLeft(lines[end-1], " "))
+		if trimmed != "" && !(strings.HasPrefix(trimmed, "#") && indent <= dash) {
+			break
+		}
+		end--
+	}
+	return end
+}
+
+// parseDocument parses the configuration file, returning an empty document for an empty file
+func parseDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("failed to parse YAML: the configuration file is not a mapping")
+	}
+	return &doc, nil
+}
+
+// rulesNode returns the sequence of rules in the document, adding an empty one if there is none
+func rulesNode(doc *yaml.Node) (*yaml.Node, error) {
+	root := doc.Content[0]
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "rules" {
+			continue
+		}
+		rules := root.Content[i+1]
+		switch {
+		case rules.Kind == yaml.SequenceNode:
+			return rules, nil
+		case rules.Tag == "!!null":
+			// "rules:" without a value
+			*rules = yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+			return rules, nil
+		}
+		return nil, fmt.Errorf("failed to parse YAML: 'rules' is not a list (line %d)", rules.Line)
+	}
+
+	rules := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+	root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "rules"}, rules)
+	return rules, nil
+}
+
+// ruleName returns the name of a rule node, or an empty string if it has none
+func ruleName(item *yaml.Node) string {
+	if item.Kind != yaml.MappingNode {
+		return ""
+	}
+	for i := 0; i+1 < len(item.Content); i += 2 {
+		if item.Content[i].Value == "name" {
+			return item.Content[i+1].Value
+		}
+	}
+	return ""
+}
+
+// detectIndent returns the indentation of the first indented line, so that edits keep the style of the file
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent >= 2 && indent <= 8 {
+			return indent
+		}
+	}
+	return defaultIndent
+}
+
+// writeDocument encodes the document and writes it to path
+func writeDocument(path string, doc *yaml.Node, indent int) error {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(indent)
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode configuration file: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return fmt.Errorf("failed to encode configuration file: %w", err)
+	}
+
+	return writeFile(path, buf.Bytes())
+}
+
+// writeFile writes the configuration file, keeping the permissions of an existing file
+func writeFile(path string, data []byte) error {
+	mode := fs.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(path, data, mode); err != nil {
+		return fmt.Errorf("failed to write configuration file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAddRule(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "config-edit-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configPath := filepath.Join(tempDir, "currm.yaml")
+	configContent := `# Rules shared by the team
+concurrency: 2 # keep it low
+
+rules:
+  # Go style guide
+  - name: "go"
+    url: "https://example.com/go.mdc"
+`
+	if err := os.WriteFile(configPath, []byte(configContent), 0600); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+
+	rule := Rule{Name: "python", URL: "https://example.com/python.mdc", Revision: "v1", Globs: "*.py", AlwaysApply: true}
+	if err := AddRule(configPath, rule); err != nil {
+		t.Fatalf("AddRule function returned an error: %v", err)
+	}
+
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read configuration file: %v", err)
+	}
+	expected := configContent + `  - name: python
+    url: https://example.com/python.mdc
+    revision: v1
+    globs: '*.py'
+    alwaysApply: true
+`
+	if string(data) != expected {
+		t.Errorf("Configuration file differs from expected. Expected: %q, Actual: %q", expected, string(data))
+	}
+
+	// The edited file still loads and keeps its permissions
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("LoadConfig function returned an error: %v", err)
+	}
+	if len(cfg.Rules) != 2 || cfg.Rules[1].Name != "python" || !cfg.Rules[1].AlwaysApply {
+		t.Errorf("Added rule was not loaded. Actual: %+v", cfg.Rules)
+	}
+	if info, err := os.Stat(configPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Permissions of the configuration file were not kept: %v", info.Mode())
+	}
+
+	// Names must be unique
+	if err := AddRule(configPath, Rule{Name: "go", URL: "https://example.com/other.mdc"}); err == nil {
+		t.Error("No error was returned for a duplicate rule name")
+	}
+
+	// Rules followed by other keys get the new rule before the comments of the next key
+	configContent = "rules:\n- name: go\n  url: https://example.com/go.mdc\n\n# HTTP settings\nhttp:\n  retries: 1"
+	if err := os.WriteFile(configPath, []byte(configContent), 0644); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+	if err := AddRule(configPath, Rule{Name: "python", Git: &GitSource{Repo: "https://example.com/rules.git", Path: "python.mdc"}}); err != nil {
+		t.Fatalf("AddRule function returned an error: %v", err)
+	}
+	data, err = os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read configuration file: %v", err)
+	}
+	expected = "rules:\n- name: go\n  url: https://example.com/go.mdc\n- name: python\n  git:\n    repo: https://example.com/rules.git\n    path: python.mdc\n\n# HTTP settings\nhttp:\n  retries: 1"
+	if string(data) != expected {
+		t.Errorf("Configuration file differs from expected. Expected: %q, Actual: %q", expected, string(data))
+	}
+}
+
+func TestAddRuleNewFile(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "config-edit-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "missing file"},
+		{name: "empty list", content: "rules: []\n"},
+		{name: "no rules key", content: "concurrency: 2\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, strings.ReplaceAll(tt.name, " ", "-")+".yaml")
+			if tt.content != "" {
+				if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+					t.Fatalf("Failed to write configuration file: %v", err)
+				}
+			}
+
+			if err := AddRule(configPath, Rule{Name: "go", URL: "https://example.com/go.mdc"}); err != nil {
+				t.Fatalf("AddRule function returned an error: %v", err)
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Failed to read configuration file: %v", err)
+			}
+			if !strings.Contains(string(data), "rules:\n  - name: go\n    url: https://example.com/go.mdc\n") {
+				t.Errorf("Rule was not added as a block. Actual: %q", string(data))
+			}
+		})
+	}
+}
+
+func TestRemoveRule(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "config-edit-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	configContent := `# Rules shared by the team
+rules:
+  # Go style guide
+  - name: go
+    url: https://example.com/go.mdc
+
+  # Python style guide
+  - name: python
+    url: https://example.com/python.mdc
+  - name: shell
+    path: rules/shell.mdc
+
+# HTTP settings
+http:
+  retries: 1
+`
+
+	tests := []struct {
+		name     string
+		content  string
+		remove   string
+		expected string
+	}{
+		{
+			name:     "first rule with its comment",
+			content:  configContent,
+			remove:   "go",
+			expected: strings.Replace(configContent, "  # Go style guide\n  - name: go\n    url: https://example.com/go.mdc\n\n", "", 1),
+		},
+		{
+			name:     "rule in the middle",
+			content:  configContent,
+			remove:   "python",
+			expected: strings.Replace(configContent, "  # Python style guide\n  - name: python\n    url: https://example.com/python.mdc\n", "", 1),
+		},
+		{
+			name:     "last rule before another key",
+			content:  configContent,
+			remove:   "shell",
+			expected: strings.Replace(configContent, "  - name: shell\n    path: rules/shell.mdc\n", "", 1),
+		},
+		{
+			name:     "flow sequence",
+			content:  "rules: [{name: go, url: https://example.com/go.mdc}, {name: python, url: https://example.com/python.mdc}]\n",
+			remove:   "go",
+			expected: "rules: [{name: python, url: 'https://example.com/python.mdc'}]\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, strings.ReplaceAll(tt.name, " ", "-")+".yaml")
+			if err := os.WriteFile(configPath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write configuration file: %v", err)
+			}
+
+			if err := RemoveRule(configPath, tt.remove); err != nil {
+				t.Fatalf("RemoveRule function returned an error: %v", err)
+			}
+
+			data, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatalf("Failed to read configuration file: %v", err)
+			}
+			if string(data) != tt.expected {
+				t.Errorf("Configuration file differs from expected. Expected: %q, Actual: %q", tt.expected, string(data))
+			}
+
+			// Removing the same rule again is an error
+			if err := RemoveRule(configPath, tt.remove); err == nil {
+				t.Error("No error was returned for a rule that does not exist")
+			}
+		})
+	}
+}
@@ -0,0 +1,426 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/guchey/currm/pkg/semver"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a mistake in the configuration file.
+// Line and Column point at the YAML node it was found at; they are 0 if the position is not known.
+type Problem struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.Line == 0:
+		return p.Message
+	case p.Column == 0:
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+}
+
+// ValidationError is returned when a configuration file breaks the schema; it lists every problem found
+type ValidationError struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration file '%s':", e.Path)
+	for _, problem := range e.Problems {
+		fmt.Fprintf(&b, "\n  %s", problem)
+	}
+	return b.String()
+}
+
+var (
+	// ruleNamePattern is the set of names that are safe to use as file names
+	ruleNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9._-]*$`)
+	// sha256Pattern matches a hex encoded SHA-256
+	sha256Pattern = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+	// typeErrorPattern splits the messages of yaml.TypeError into line and message
+	typeErrorPattern = regexp.MustCompile(`^line (\d+): (.*)$`)
+	// unknownFieldPattern matches the message of KnownFields for a key that no field has
+	unknownFieldPattern = regexp.MustCompile(`^field (.+) not found in type \S+$`)
+)
+
+// gitSchemes are the URL schemes a git repository may be fetched with
+var gitSchemes = []string{"file", "git", "http", "https", "ssh"}
+
+// providerNames are the providers self-hosted instances can be configured for
+var providerNames = []string{"bitbucket", "forgejo", "gitea", "github", "gitlab"}
+
+var (
+	urlSchemesMu sync.RWMutex
+	urlSchemes   = map[string]bool{"http": true, "https": true, "file": true}
+)
+
+// AllowURLScheme accepts the scheme in the url of rules; sources registered for a scheme allow it
+func AllowURLScheme(scheme string) {
+	urlSchemesMu.Lock()
+	defer urlSchemesMu.Unlock()
+	urlSchemes[strings.ToLower(scheme)] = true
+}
+
+// allowedURLSchemes returns the sorted schemes accepted in the url of rules
+func allowedURLSchemes() []string {
+	urlSchemesMu.RLock()
+	defer urlSchemesMu.RUnlock()
+	var schemes []string
+	for scheme := range urlSchemes {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// validator collects the problems of a configuration and looks up their positions in the document
+type validator struct {
+	problems []Problem
+}
+
+// add records a problem at the position of node, which may be nil
+func (v *validator) add(node *yaml.Node, format string, args ...any) {
+	problem := Problem{Message: fmt.Sprintf(format, args...)}
+	if node != nil {
+		problem.Line, problem.Column = node.Line, node.Column
+	}
+	v.problems = append(v.problems, problem)
+}
+
+// addTypeErrors records the errors of decoding, which only know their line.
+// Unknown fields get the column of their key.
+func (v *validator) addTypeErrors(doc *yaml.Node, err *yaml.TypeError) {
+	for _, message := range err.Errors {
+		match := typeErrorPattern.FindStringSubmatch(message)
+		if match == nil {
+			v.add(nil, "%s", message)
+			continue
+		}
+		line, _ := strconv.Atoi(match[1])
+		problem := Problem{Line: line, Message: match[2]}
+		if field := unknownFieldPattern.FindStringSubmatch(match[2]); field != nil {
+			problem.Message = fmt.Sprintf("unknown field '%s'", field[1])
+			if key := findKey(doc, line, field[1]); key != nil {
+				problem.Column = key.Column
+			}
+		}
+		v.problems = append(v.problems, problem)
+	}
+}
+
+// findKey returns the mapping key with the given value at the line, or nil if there is none
+func findKey(node *yaml.Node, line int, value string) *yaml.Node {
+	if node == nil {
+		return nil
+	}
+	for i, child := range node.Content {
+		if node.Kind == yaml.MappingNode && i%2 == 0 && child.Line == line && child.Value == value {
+			return child
+		}
+		if key := findKey(child, line, value); key != nil {
+			return key
+		}
+	}
+	return nil
+}
+
+// mappingKey returns the key node of key in a mapping node, or nil if the node is no mapping or lacks the key
+func mappingKey(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i]
+		}
+	}
+	return nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil if the node is no mapping or lacks the key
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// at returns the value of key in the mapping node, or the node itself if the key is missing, to point problems at
+func at(node *yaml.Node, key string) *yaml.Node {
+	if value := mappingValue(node, key); value != nil {
+		return value
+	}
+	return node
+}
+
+// validate checks the decoded configuration against the rules the schema cannot express
+func (v *validator) validate(doc *yaml.Node, cfg *Config) {
+	var root *yaml.Node
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+
+	if cfg.Concurrency < 0 {
+		v.add(at(root, "concurrency"), "concurrency must not be negative")
+	}
+	if cfg.PerHostConcurrency < 0 {
+		v.add(at(root, "perHostConcurrency"), "perHostConcurrency must not be negative")
+	}
+	v.validateHTTP(mappingValue(root, "http"), cfg.HTTP)
+	if cfg.GitHubAPIURL != "" {
+		if u, err := url.Parse(cfg.GitHubAPIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			v.add(at(root, "githubApiUrl"), "githubApiUrl must be an http or https URL")
+		}
+	}
+	providers := mappingValue(root, "providers")
+	var providerKeys []string
+	for provider := range cfg.Providers {
+		providerKeys = append(providerKeys, provider)
+	}
+	sort.Strings(providerKeys)
+	for _, provider := range providerKeys {
+		hosts := cfg.Providers[provider]
+		if !contains(providerNames, strings.ToLower(provider)) {
+			v.add(mappingKey(providers, provider), "unknown provider '%s'; use %s", provider, strings.Join(providerNames, ", "))
+		}
+		for _, host := range hosts {
+			if host == "" || strings.ContainsAny(host, "/: ") {
+				v.add(at(providers, provider), "host '%s' of provider '%s' must be a host name without scheme or path", host, provider)
+			}
+		}
+	}
+
+	var items []*yaml.Node
+	if rules := mappingValue(root, "rules"); rules != nil && rules.Kind == yaml.SequenceNode {
+		items = rules.Content
+	}
+	names := make(map[string]int)
+	for i, rule := range cfg.Rules {
+		var item *yaml.Node
+		if i < len(items) {
+			item = items[i]
+		}
+		v.validateRule(item, rule, names)
+	}
+}
+
+// validateHTTP checks that timeouts and retries are not negative
+func (v *validator) validateHTTP(node *yaml.Node, http HTTPConfig) {
+	durations := []struct {
+		key   string
+		value int64
+	}{
+		{"timeout", int64(http.Timeout)},
+		{"requestTimeout", int64(http.RequestTimeout)},
+		{"initialBackoff", int64(http.InitialBackoff)},
+		{"maxBackoff", int64(http.MaxBackoff)},
+	}
+	for _, duration := range durations {
+		if duration.value < 0 {
+			v.add(at(node, duration.key), "http.%s must not be negative", duration.key)
+		}
+	}
+	if http.Retries != nil && *http.Retries < 0 {
+		v.add(at(node, "retries"), "http.retries must not be negative")
+	}
+}
+
+// validateRule checks a single rule; names maps the names seen so far to their line
+func (v *validator) validateRule(item *yaml.Node, rule Rule, names map[string]int) {
+	label := fmt.Sprintf("rule '%s'", rule.Name)
+	switch {
+	case rule.Name == "":
+		// The files imported by a dir rule are named after it and recorded as imported from it
+		v.add(item, "rule has no name")
+		label = "rule"
+	case !ruleNamePattern.MatchString(rule.Name):
+		v.add(at(item, "name"), "%v", ValidateRuleName(rule.Name))
+	default:
+		if line, ok := names[rule.Name]; ok {
+			v.add(at(item, "name"), "rule name '%s' is already used at line %d", rule.Name, line)
+		} else if node := at(item, "name"); node != nil {
+			names[rule.Name] = node.Line
+		} else {
+			names[rule.Name] = 0
+		}
+	}
+
+	sources := 0
+	for _, set := range []bool{rule.URL != "", rule.Path != "", rule.Git != nil, rule.Dir != nil} {
+		if set {
+			sources++
+		}
+	}
+	switch {
+	case sources == 0:
+		v.add(item, "%s has no url, path, git or dir source", label)
+	case sources > 1:
+		v.add(item, "%s sets more than one of url, path, git and dir; use only one", label)
+	}
+
+	if rule.URL != "" {
+		if err := checkURL(rule.URL, allowedURLSchemes()); err != nil {
+			v.add(at(item, "url"), "url of %s %v", label, err)
+		}
+	}
+	if rule.Git != nil {
+		v.validateGit(at(item, "git"), rule.Git, label, false)
+	}
+	if rule.Dir != nil {
+		dir := at(item, "dir")
+		if (rule.Dir.URL == "") == (rule.Dir.Git == nil) {
+			v.add(dir, "dir of %s requires either url or git", label)
+		}
+		if rule.Dir.URL != "" {
+			if err := checkURL(rule.Dir.URL, allowedURLSchemes()); err != nil {
+				v.add(at(dir, "url"), "url of the dir of %s %v", label, err)
+			}
+		}
+		if rule.Dir.Git != nil {
+			v.validateGit(at(dir, "git"), rule.Dir.Git, label, true)
+		}
+		for key, patterns := range map[string][]string{"include": rule.Dir.Include, "exclude": rule.Dir.Exclude} {
+			for _, pattern := range patterns {
+				if _, err := path.Match(pattern, ""); err != nil {
+					v.add(at(dir, key), "invalid pattern '%s' in %s: %v", pattern, label, err)
+				}
+			}
+		}
+	}
+
+	if rule.Revision != "" {
+		if err := checkRevision(rule.Revision); err != nil {
+			v.add(at(item, "revision"), "revision of %s %v", label, err)
+		} else if rule.Revision != "latest" && (rule.Path != "" || strings.HasPrefix(strings.ToLower(rule.URL), "file:")) {
+			v.add(at(item, "revision"), "revision of %s cannot be applied to a local file; remove it", label)
+		}
+	}
+	if rule.SHA256 != "" && !sha256Pattern.MatchString(rule.SHA256) {
+		v.add(at(item, "sha256"), "sha256 of %s must be 64 hexadecimal characters", label)
+	}
+}
+
+// validateGit checks the repository, ref and path of a git source; the path of a directory may be empty
+func (v *validator) validateGit(node *yaml.Node, git *GitSource, label string, isDir bool) {
+	if err := checkRepo(git.Repo); err != nil {
+		v.add(at(node, "repo"), "repo of %s %v", label, err)
+	}
+	if git.Ref != "" {
+		if err := checkRef(git.Ref); err != nil {
+			v.add(at(node, "ref"), "ref of %s %v", label, err)
+		}
+	}
+	switch {
+	case git.Path == "" && !isDir:
+		v.add(node, "git source of %s has no path", label)
+	case strings.HasPrefix(git.Path, "-"):
+		v.add(at(node, "path"), "path of %s must not start with '-'", label)
+	}
+}
+
+// ValidateRuleName checks that the name of a rule is safe to use as a file name
+func ValidateRuleName(name string) error {
+	if !ruleNamePattern.MatchString(name) {
+		return fmt.Errorf("rule name '%s' may only contain letters, digits, '.', '_' and '-' and must not start with '.' or '-'", name)
+	}
+	return nil
+}
+
+// checkURL checks that the URL is absolute and uses one of the schemes
+func checkURL(rawURL string, schemes []string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("is not a valid URL: %w", errors.Unwrap(err))
+	}
+	if u.Scheme == "" {
+		return fmt.Errorf("must be an absolute URL such as https://example.com/rule.mdc")
+	}
+	if !contains(schemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("uses unsupported scheme '%s'; use %s", u.Scheme, strings.Join(schemes, ", "))
+	}
+	if u.Scheme != "file" && u.Host == "" && u.Opaque == "" {
+		return fmt.Errorf("has no host")
+	}
+	return nil
+}
+
+// checkRepo checks a repository that git can fetch: a URL, an scp-like address such as git@host:owner/repo.git, or a local path
+func checkRepo(repo string) error {
+	switch {
+	case repo == "":
+		return fmt.Errorf("is missing")
+	case strings.HasPrefix(repo, "-"):
+		// git would read it as an option
+		return fmt.Errorf("must not start with '-'")
+	case strings.ContainsAny(repo, "\n\r\x00"):
+		return fmt.Errorf("contains control characters")
+	case strings.Contains(repo, "://"):
+		return checkURL(repo, gitSchemes)
+	}
+	return nil
+}
+
+// checkRevision checks a revision: "latest", a version range or a ref name
+func checkRevision(revision string) error {
+	if revision == "latest" {
+		return nil
+	}
+	if semver.IsConstraint(revision) {
+		if _, err := semver.ParseConstraint(revision); err != nil {
+			return fmt.Errorf("is not a valid version range: %w", err)
+		}
+		return nil
+	}
+	return checkRef(revision)
+}
+
+// checkRef checks a branch, tag or commit against the rules of git check-ref-format
+func checkRef(ref string) error {
+	for _, r := range ref {
+		if r < 0x20 || r == 0x7f || r == ' ' {
+			return fmt.Errorf("'%s' must not contain spaces or control characters", ref)
+		}
+	}
+	switch {
+	case strings.ContainsAny(ref, "~^:?*[\\"):
+		return fmt.Errorf("'%s' must not contain any of ~ ^ : ? * [ \\", ref)
+	case strings.Contains(ref, "..") || strings.Contains(ref, "@{") || strings.Contains(ref, "//"):
+		return fmt.Errorf("'%s' must not contain '..', '@{' or '//'", ref)
+	case strings.HasPrefix(ref, "-") || strings.HasPrefix(ref, "/") || strings.HasPrefix(ref, "."):
+		return fmt.Errorf("'%s' must not start with '-', '/' or '.'", ref)
+	case strings.HasSuffix(ref, "/") || strings.HasSuffix(ref, ".") || strings.HasSuffix(ref, ".lock"):
+		return fmt.Errorf("'%s' must not end with '/', '.' or '.lock'", ref)
+	}
+	return nil
+}
+
+// contains reports whether the values include value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,203 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadConfigValidation(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "validate-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	testCases := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name: "valid configuration",
+			content: `concurrency: 4
+providers:
+  gitlab: [git.example.com]
+  forgejo: [codeberg.org]
+rules:
+  - name: go
+    url: https://example.com/go.mdc
+    revision: v1.2.0
+    sha256: ` + strings.Repeat("a", 64) + `
+  - name: python_3.12
+    path: rules/python.mdc
+  - name: team
+    git:
+      repo: git@github.com:owner/rules.git
+      ref: release/2024
+      path: go.mdc
+    revision: ^1.2
+  - name: imported
+    dir:
+      url: https://github.com/owner/repo/tree/main/rules
+      include: ["*.mdc"]
+`,
+		},
+		{
+			name:    "empty file",
+			content: "",
+		},
+		{
+			name: "unknown keys",
+			content: `rules:
+  - name: go
+    url: https://example.com/go.mdc
+    alwaysapply: true
+concurency: 4
+`,
+			expected: []string{
+				"line 4, column 5: unknown field 'alwaysapply'",
+				"line 5, column 1: unknown field 'concurency'",
+			},
+		},
+		{
+			name: "names",
+			content: `rules:
+  - name: go
+    url: https://example.com/go.mdc
+  - name: go
+    url: https://example.com/go2.mdc
+  - name: ../../.git/hooks/pre-commit
+    url: https://example.com/hook.mdc
+  - url: https://example.com/nameless.mdc
+  - dir:
+      url: https://github.com/owner/repo/tree/main/rules
+`,
+			expected: []string{
+				"line 4, column 11: rule name 'go' is already used at line 2",
+				"line 6, column 11: rule name '../../.git/hooks/pre-commit' may only contain letters, digits, '.', '_' and '-' and must not start with '.' or '-'",
+				"line 8, column 5: rule has no name",
+				"line 9, column 5: rule has no name",
+			},
+		},
+		{
+			name: "sources",
+			content: `rules:
+  - name: none
+    description: no source
+  - name: both
+    url: https://example.com/go.mdc
+    path: go.mdc
+  - name: ftp
+    url: ftp://example.com/go.mdc
+  - name: relative
+    url: example.com/go.mdc
+  - name: option
+    git:
+      repo: --upload-pack=touch /tmp/pwned
+      path: go.mdc
+  - name: nopath
+    git:
+      repo: https://example.com/rules.git
+`,
+			expected: []string{
+				"line 2, column 5: rule 'none' has no url, path, git or dir source",
+				"line 4, column 5: rule 'both' sets more than one of url, path, git and dir; use only one",
+				"line 8, column 10: url of rule 'ftp' uses unsupported scheme 'ftp'; use file, http, https",
+				"line 10, column 10: url of rule 'relative' must be an absolute URL such as https://example.com/rule.mdc",
+				"line 13, column 13: repo of rule 'option' must not start with '-'",
+				"line 17, column 7: git source of rule 'nopath' has no path",
+			},
+		},
+		{
+			name: "revisions and checksums",
+			content: `rules:
+  - name: dots
+    url: https://example.com/go.mdc
+    revision: main..feature
+  - name: range
+    url: https://example.com/go.mdc
+    revision: ^one
+  - name: space
+    url: https://example.com/go.mdc
+    revision: "my branch"
+  - name: sum
+    url: https://example.com/go.mdc
+    sha256: abc
+  - name: local
+    path: rules/go.mdc
+    revision: v1
+`,
+			expected: []string{
+				"line 4, column 15: revision of rule 'dots' 'main..feature' must not contain '..', '@{' or '//'",
+				"line 7, column 15: revision of rule 'range' is not a valid version range: ",
+				"line 10, column 15: revision of rule 'space' 'my branch' must not contain spaces or control characters",
+				"line 13, column 13: sha256 of rule 'sum' must be 64 hexadecimal characters",
+				"line 16, column 15: revision of rule 'local' cannot be applied to a local file; remove it",
+			},
+		},
+		{
+			name: "settings",
+			content: `concurrency: -1
+githubApiUrl: api.github.com
+providers:
+  sourcehut: [git.example.com]
+rules: []
+`,
+			expected: []string{
+				"line 1, column 14: concurrency must not be negative",
+				"line 2, column 15: githubApiUrl must be an http or https URL",
+				"line 4, column 3: unknown provider 'sourcehut'; use bitbucket, forgejo, gitea, github, gitlab",
+			},
+		},
+	}
+
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(tempDir, "currm"+string(rune('a'+i))+".yaml")
+			if err := os.WriteFile(configPath, []byte(tc.content), 0644); err != nil {
+				t.Fatalf("Failed to write configuration file: %v", err)
+			}
+
+			_, err := LoadConfig(configPath)
+			if len(tc.expected) == 0 {
+				if err != nil {
+					t.Fatalf("LoadConfig function returned an error: %v", err)
+				}
+				return
+			}
+
+			var validationErr *ValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("LoadConfig function did not return a ValidationError: %v", err)
+			}
+			if len(validationErr.Problems) != len(tc.expected) {
+				t.Fatalf("Number of problems does not match. Expected: %d, Actual: %d\n%v", len(tc.expected), len(validationErr.Problems), err)
+			}
+			for j, expected := range tc.expected {
+				if actual := validationErr.Problems[j].String(); !strings.HasPrefix(actual, expected) {
+					t.Errorf("Problem %d differs from expected. Expected: %s, Actual: %s", j, expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateRuleName(t *testing.T) {
+	valid := []string{"go", "python_3.12", "dry-solid-principles", "_private"}
+	for _, name := range valid {
+		if err := ValidateRuleName(name); err != nil {
+			t.Errorf("Name '%s' was rejected: %v", name, err)
+		}
+	}
+
+	invalid := []string{"", ".hidden", "-rf", "../go", "rules/go", "go rule", `C:\go`, "go\x00"}
+	for _, name := range invalid {
+		if err := ValidateRuleName(name); err == nil {
+			t.Errorf("Name '%s' was accepted", name)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/guchey/currm/pkg/auth"
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+// RuleState describes how the installed file of a rule relates to its remote content
+type RuleState string
+
+const (
+	// StateUpToDate means the installed file matches the remote content
+	StateUpToDate RuleState = "up-to-date"
+	// StateNotInstalled means there is no installed file for the rule
+	StateNotInstalled RuleState = "not-installed"
+	// StateUpstreamChanged means the remote content changed since the rule was installed
+	StateUpstreamChanged RuleState = "upstream-changed"
+	// StateModifiedLocally means the installed file was edited after it was installed
+	StateModifiedLocally RuleState = "modified-locally"
+	// StateBothChanged means the installed file was edited and the remote content changed as well
+	StateBothChanged RuleState = "both-changed"
+	// StateNewerCompatible means a newer tag within the version range of the rule was released since it was installed
+	StateNewerCompatible RuleState = "newer-compatible"
+	// StateNewerMajor means the installed file is current, but a tag above the version range exists, such as a new major version
+	StateNewerMajor RuleState = "newer-major"
+	// StateError means the rule could not be checked; Error tells why
+	StateError RuleState = "error"
+)
+
+// RuleStatus represents the status of a rule
+type RuleStatus struct {
+	Name           string    `json:"name" yaml:"name"`
+	LocalPath      string    `json:"localPath" yaml:"localPath"`
+	HasLocalFile   bool      `json:"hasLocalFile" yaml:"hasLocalFile"`
+	NeedsUpdate    bool      `json:"needsUpdate" yaml:"needsUpdate"`
+	LastModified   time.Time `json:"lastModified" yaml:"lastModified"`
+	RemoteModified time.Time `json:"remoteModified" yaml:"remoteModified"`
+	Revision       string    `json:"revision,omitempty" yaml:"revision,omitempty"`
+	// IntegrityMismatch is set when the remote content no longer matches the sha256 pinned in the configuration
+	IntegrityMismatch bool   `json:"integrityMismatch,omitempty" yaml:"integrityMismatch,omitempty"`
+	RemoteSHA256      string `json:"remoteSha256,omitempty" yaml:"remoteSha256,omitempty"`
+	// State compares the installed file, the content installed last time and the remote content
+	State RuleState `json:"state" yaml:"state"`
+	// Error is the reason the rule could not be checked when State is StateError
+	Error string `json:"error,omitempty" yaml:"error,omitempty"`
+	// LocalSHA256 is the hash of the installed file
+	LocalSHA256 string `json:"localSha256,omitempty" yaml:"localSha256,omitempty"`
+	// InstalledSHA256 is the hash of the file as currm wrote it, if known
+	InstalledSHA256 string `json:"installedSha256,omitempty" yaml:"installedSha256,omitempty"`
+	// UpstreamSHA256 is the hash of the remote content after conversion
+	UpstreamSHA256 string `json:"upstreamSha256,omitempty" yaml:"upstreamSha256,omitempty"`
+	// InstalledCommit is the commit recorded in the lockfile for the installed file, if known
+	InstalledCommit string `json:"installedCommit,omitempty" yaml:"installedCommit,omitempty"`
+	// UpstreamCommit is the commit the revision resolves to now, if the source can tell
+	UpstreamCommit string `json:"upstreamCommit,omitempty" yaml:"upstreamCommit,omitempty"`
+	// InstalledTag is the tag a version range resolved to when the rule was installed, if known
+	InstalledTag string `json:"installedTag,omitempty" yaml:"installedTag,omitempty"`
+	// UpstreamTag is the highest tag in the version range now
+	UpstreamTag string `json:"upstreamTag,omitempty" yaml:"upstreamTag,omitempty"`
+	// NewerMajor is a tag above the version range, such as a new major version, if there is one
+	NewerMajor string `json:"newerMajor,omitempty" yaml:"newerMajor,omitempty"`
+}
+
+// CheckRuleUpdates checks if any rules need to be updated.
+// Rules that cannot be checked are reported with StateError in the results. An error is only returned
+// if the check cannot start, for example because the lockfile or a directory of a dir rule cannot be read.
+func CheckRuleUpdates(cfg *config.Config, opts Options) ([]RuleStatus, error) {
+	// Get the directory where rules are stored
+	rulesDir, err := projectRulesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newRunner(cfg, opts, rulesDir)
+	if err != nil {
+		return nil, err
+	}
+
+	// The lockfile tells what was installed, which separates local edits from upstream changes
+	lock, err := lockfile.Load(lockfile.PathFor(cfg.Path))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		lock = lockfile.New()
+	}
+
+	// Dir rules are checked file by file
+	cfg, err = r.expandRules(cfg, lock, false)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check each rule defined in the configuration; a rule that fails does not hide the others
+	statuses := make([]RuleStatus, len(cfg.Rules))
+	r.forEachRule(cfg, opts, func(i int, rule config.Rule) {
+		status, err := r.check(rule, lock.Find(rule.Name))
+		if err != nil {
+			status = RuleStatus{Name: rule.Name, Revision: rule.Revision, State: StateError, Error: err.Error()}
+		}
+		statuses[i] = status
+	})
+
+	return statuses, nil
+}
+
+// check compares the installed file of a single rule with its remote content
+func (r *runner) check(rule config.Rule, locked *lockfile.LockedRule) (RuleStatus, error) {
+	// Resolve where the rule is fetched from
+	t, err := r.resolve(rule, "")
+	if err != nil {
+		return RuleStatus{}, err
+	}
+	location := t.location
+
+	// Create the full path where the file should be
+	filePath, err := rulePath(r.rulesDir, rule)
+	if err != nil {
+		return RuleStatus{}, err
+	}
+
+	status := RuleStatus{
+		Name:        rule.Name,
+		LocalPath:   filePath,
+		Revision:    rule.Revision,
+		UpstreamTag: t.tag,
+		NewerMajor:  t.newer,
+	}
+
+	// Hash the installed file if there is one
+	fileInfo, err := os.Stat(filePath)
+	if err == nil {
+		status.HasLocalFile = true
+		status.LastModified = fileInfo.ModTime()
+
+		local, err := os.ReadFile(filePath)
+		if err != nil {
+			return RuleStatus{}, fmt.Errorf("failed to read file '%s': %w", filePath, err)
+		}
+		status.LocalSHA256 = sha256Hex(local)
+	} else if !os.IsNotExist(err) {
+		return RuleStatus{}, fmt.Errorf("failed to check file '%s': %w", filePath, err)
+	}
+
+	// Determine what was installed, preferring the lockfile over the cache.
+	// The location of a version range moves with its tag, so the lockfile describes the installed file regardless.
+	validators := r.validators(rule, location)
+	if locked != nil && lockMatchesRule(*locked, rule) && (locked.ResolvedURL == auth.Redact(location) || locked.ResolvedRevision != "") {
+		status.InstalledSHA256 = locked.SHA256
+		status.InstalledCommit = locked.ResolvedCommit
+		status.InstalledTag = locked.ResolvedRevision
+	} else if validators != nil {
+		status.InstalledSHA256 = validators.InstalledSHA256
+	}
+
+	// Only trust a 304 if the validators describe the content that is considered installed
+	if validators != nil && validators.InstalledSHA256 != status.InstalledSHA256 {
+		validators = nil
+	}
+
+	resp, err := t.source.Fetch(r.request(t.rule, location, validators))
+	if err != nil {
+		return RuleStatus{}, err
+	}
+
+	status.UpstreamCommit = resolvedCommit(t.rule)
+	if resp.Revision != "" {
+		status.UpstreamCommit = resp.Revision
+	}
+
+	if resp.NotModified && validators != nil {
+		status.RemoteSHA256 = validators.ContentSHA256
+		status.UpstreamSHA256 = validators.InstalledSHA256
+	} else {
+		// Local files are converted based on their own name
+		name := location
+		if resp.Path != "" {
+			name = resp.Path
+		}
+		status.RemoteSHA256 = sha256Hex(resp.Content)
+		status.UpstreamSHA256 = sha256Hex(renderRule(rule, name, resp.Content))
+		if remoteTime, err := time.Parse(time.RFC1123, resp.LastModified); err == nil {
+			status.RemoteModified = remoteTime
+		}
+	}
+
+	if rule.SHA256 != "" {
+		status.IntegrityMismatch = !strings.EqualFold(status.RemoteSHA256, rule.SHA256)
+	}
+
+	status.State = compareHashes(status)
+	switch {
+	case (status.State == StateUpToDate || status.State == StateUpstreamChanged) && status.InstalledTag != "" && status.InstalledTag != status.UpstreamTag:
+		// The lockfile moves to the new tag even if the content of the rule did not change
+		status.State = StateNewerCompatible
+	case status.State == StateUpToDate && status.NewerMajor != "":
+		// Moving to a tag outside the range has to be done in the configuration, so nothing needs updating
+		status.State = StateNewerMajor
+	}
+	status.NeedsUpdate = status.State == StateNotInstalled || status.State == StateUpstreamChanged || status.State == StateBothChanged || status.State == StateNewerCompatible
+
+	return status, nil
+}
+
+// compareHashes derives the state of a rule from the hashes of the installed, last installed and remote content
+func compareHashes(status RuleStatus) RuleState {
+	switch {
+	case !status.HasLocalFile:
+		return StateNotInstalled
+	case status.LocalSHA256 == status.UpstreamSHA256:
+		return StateUpToDate
+	case status.InstalledSHA256 == "":
+		// Without knowing what was installed, any difference has to be fetched again
+		return StateUpstreamChanged
+	}
+
+	localChanged := status.LocalSHA256 != status.InstalledSHA256
+	upstreamChanged := status.UpstreamSHA256 != status.InstalledSHA256
+	switch {
+	case localChanged && upstreamChanged:
+		return StateBothChanged
+	case localChanged:
+		return StateModifiedLocally
+	default:
+		return StateUpstreamChanged
+	}
+}
@@ -0,0 +1,240 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+func TestConditionalRequests(t *testing.T) {
+	content := "Cached rule content"
+	etag := `"v1"`
+	var fullResponses int32
+
+	// Create HTTP test server that supports ETag validation
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		atomic.AddInt32(&fullResponses, 1)
+		w.Header().Set("ETag", etag)
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "conditional-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "cached", URL: server.URL + "/cached.mdc"}},
+		Path:  filepath.Join(tempDir, "currm.yaml"),
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+	rulePath := filepath.Join(tempDir, ".cursor", "rules", "cached.mdc")
+
+	// The first pull downloads the content
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	if fullResponses != 1 {
+		t.Fatalf("Expected 1 full response, Actual: %d", fullResponses)
+	}
+
+	// check reports the rule as up to date from a 304 response
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	if statuses[0].NeedsUpdate {
+		t.Error("Rule was reported as outdated although the server answered 304")
+	}
+
+	// The second pull receives 304 and leaves the file alone
+	before, err := os.Stat(rulePath)
+	if err != nil {
+		t.Fatalf("Failed to stat rule file: %v", err)
+	}
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	after, err := os.Stat(rulePath)
+	if err != nil {
+		t.Fatalf("Failed to stat rule file: %v", err)
+	}
+	if fullResponses != 1 || !after.ModTime().Equal(before.ModTime()) {
+		t.Errorf("Rule was downloaded again although it was not modified. Full responses: %d", fullResponses)
+	}
+
+	// A locally modified file is downloaded again instead of trusting the validators
+	if err := os.WriteFile(rulePath, []byte("edited"), 0644); err != nil {
+		t.Fatalf("Failed to modify rule file: %v", err)
+	}
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	restored, err := os.ReadFile(rulePath)
+	if err != nil {
+		t.Fatalf("Failed to read rule file: %v", err)
+	}
+	if string(restored) != content {
+		t.Errorf("Locally modified rule was not restored. Actual: %s", string(restored))
+	}
+
+	// An upstream change is reported by check
+	etag = `"v2"`
+	content = "Changed rule content"
+	statuses, err = CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	if !statuses[0].NeedsUpdate {
+		t.Error("Rule was not reported as outdated after the ETag changed")
+	}
+}
+
+func TestCheckRuleStates(t *testing.T) {
+	remote := map[string]string{}
+
+	// Create HTTP test server that serves the current remote content
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(remote["/"+path.Base(r.URL.Path)]))
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "check-states-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	names := []string{"unchanged", "local", "upstream", "both", "pinned", "converted"}
+	cfg := &config.Config{
+		Path: filepath.Join(tempDir, "currm.yaml"),
+		// The test server stands in for a self-hosted GitLab so that revisions can be applied
+		Providers: map[string][]string{"gitlab": {"127.0.0.1"}},
+	}
+	for _, name := range names {
+		rule := config.Rule{Name: name, URL: server.URL + "/" + name + ".mdc"}
+		switch name {
+		case "pinned":
+			// Pinned revisions are compared by content as well
+			rule.Revision = "v1.0.0"
+			rule.URL = server.URL + "/group/project/-/raw/main/pinned.mdc"
+		case "converted":
+			// The remote content is converted before it is compared
+			rule.URL = server.URL + "/converted.cursorrules"
+		}
+		remote["/"+filepath.Base(rule.URL)] = "original " + name
+		cfg.Rules = append(cfg.Rules, rule)
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	// Edit some installed files and some remote files
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	for _, name := range []string{"local", "both"} {
+		if err := os.WriteFile(filepath.Join(rulesDir, name+".mdc"), []byte("edited"), 0644); err != nil {
+			t.Fatalf("Failed to modify rule file: %v", err)
+		}
+	}
+	mu.Lock()
+	remote["/upstream.mdc"] = "changed upstream"
+	remote["/both.mdc"] = "changed upstream"
+	remote["/pinned.mdc"] = "changed upstream"
+	mu.Unlock()
+
+	// A rule that was never installed
+	cfg.Rules = append(cfg.Rules, config.Rule{Name: "missing", URL: server.URL + "/missing.mdc"})
+
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+
+	expected := map[string]RuleState{
+		"unchanged": StateUpToDate,
+		"local":     StateModifiedLocally,
+		"upstream":  StateUpstreamChanged,
+		"both":      StateBothChanged,
+		"pinned":    StateUpstreamChanged,
+		"converted": StateUpToDate,
+		"missing":   StateNotInstalled,
+	}
+	for _, status := range statuses {
+		if status.State != expected[status.Name] {
+			t.Errorf("State of rule '%s' does not match. Expected: %s, Actual: %s", status.Name, expected[status.Name], status.State)
+		}
+		needsUpdate := expected[status.Name] != StateUpToDate && expected[status.Name] != StateModifiedLocally
+		if status.NeedsUpdate != needsUpdate {
+			t.Errorf("NeedsUpdate of rule '%s' does not match. Expected: %t, Actual: %t", status.Name, needsUpdate, status.NeedsUpdate)
+		}
+	}
+}
+
+func TestCompareHashes(t *testing.T) {
+	testCases := []struct {
+		name     string
+		status   RuleStatus
+		expected RuleState
+	}{
+		{"Not installed", RuleStatus{}, StateNotInstalled},
+		{"Same content", RuleStatus{HasLocalFile: true, LocalSHA256: "a", InstalledSHA256: "b", UpstreamSHA256: "a"}, StateUpToDate},
+		{"Unknown baseline", RuleStatus{HasLocalFile: true, LocalSHA256: "a", UpstreamSHA256: "b"}, StateUpstreamChanged},
+		{"Local edit", RuleStatus{HasLocalFile: true, LocalSHA256: "b", InstalledSHA256: "a", UpstreamSHA256: "a"}, StateModifiedLocally},
+		{"Upstream change", RuleStatus{HasLocalFile: true, LocalSHA256: "a", InstalledSHA256: "a", UpstreamSHA256: "b"}, StateUpstreamChanged},
+		{"Both changed", RuleStatus{HasLocalFile: true, LocalSHA256: "b", InstalledSHA256: "a", UpstreamSHA256: "c"}, StateBothChanged},
+	}
+
+	for _, tc := range testCases {
+		if actual := compareHashes(tc.status); actual != tc.expected {
+			t.Errorf("%s: Expected: %s, Actual: %s", tc.name, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package downloader
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+	"github.com/guchey/currm/pkg/semver"
+)
+
+// ruleFileExtensions are the extensions of the files a dir rule imports
+var ruleFileExtensions = []string{".mdc", ".cursorrules"}
+
+// expandRules returns the configuration with every dir rule replaced by rules for the files it imports.
+// When fromLock is set, the imported files are taken from the lockfile instead of listing the directory.
+func (r *runner) expandRules(cfg *config.Config, lock *lockfile.Lockfile, fromLock bool) (*config.Config, error) {
+	hasDir := false
+	for _, rule := range cfg.Rules {
+		if rule.Dir != nil {
+			hasDir = true
+			break
+		}
+	}
+	if !hasDir {
+		return cfg, nil
+	}
+
+	expanded := *cfg
+	expanded.Rules = nil
+	for _, rule := range cfg.Rules {
+		if rule.Dir == nil {
+			expanded.Rules = append(expanded.Rules, rule)
+			continue
+		}
+
+		if err := validateDirRule(rule); err != nil {
+			return nil, err
+		}
+
+		var imported []config.Rule
+		var err error
+		if fromLock {
+			imported, err = importedFromLock(rule, lock)
+		} else {
+			imported, err = r.listDir(rule)
+		}
+		if err != nil {
+			return nil, err
+		}
+		expanded.Rules = append(expanded.Rules, imported...)
+	}
+
+	// Imported rules are named after their path, which may clash with other rules
+	seen := make(map[string]bool)
+	for _, rule := range expanded.Rules {
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("more than one rule is named '%s'; rename the rule or exclude the imported file", rule.Name)
+		}
+		seen[rule.Name] = true
+	}
+
+	return &expanded, nil
+}
+
+// validateDirRule checks that a dir rule has a name, names exactly one directory and that its patterns are valid
+func validateDirRule(rule config.Rule) error {
+	dir := rule.Dir
+	if rule.Name == "" {
+		// Imported rules are named after the dir rule and found by its name in the lockfile
+		return fmt.Errorf("a dir rule has no name; the rules it imports are named after it")
+	}
+	if rule.URL != "" || rule.Path != "" || rule.Git != nil {
+		return fmt.Errorf("rule '%s' sets dir together with url, path or git; use only one", rule.Name)
+	}
+	if (dir.URL == "") == (dir.Git == nil) {
+		return fmt.Errorf("dir of rule '%s' requires either url or git", rule.Name)
+	}
+
+	for _, pattern := range append(append([]string{}, dir.Include...), dir.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid pattern '%s' in rule '%s': %w", pattern, rule.Name, err)
+		}
+	}
+	return nil
+}
+
+// listDir lists the directory of a dir rule and returns rules for the files it imports
+func (r *runner) listDir(rule config.Rule) ([]config.Rule, error) {
+	dirRule := config.Rule{Name: rule.Name, URL: rule.Dir.URL, Git: rule.Dir.Git, Revision: rule.Revision}
+	source, err := r.lookup(dirRule)
+	if err != nil {
+		return nil, err
+	}
+
+	lister, ok := source.(DirLister)
+	if !ok {
+		return nil, fmt.Errorf("the directory of rule '%s' cannot be listed; use a GitHub URL or a git source", rule.Name)
+	}
+
+	// A version range is listed at the tag it resolves to now
+	t := &target{source: source, rule: dirRule}
+	if semver.IsConstraint(rule.Revision) {
+		if err := r.resolveRange(t, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	files, err := lister.ListDir(r.request(t.rule, "", nil))
+	if err != nil {
+		return nil, err
+	}
+
+	var imported []config.Rule
+	for _, file := range files {
+		if importsFile(rule.Dir, file.Name) {
+			imported = append(imported, importedRule(rule, file))
+		}
+	}
+	if len(imported) == 0 {
+		return nil, fmt.Errorf("the directory of rule '%s' contains no rule files matching its patterns", rule.Name)
+	}
+	return imported, nil
+}
+
+// importedFromLock returns the rules for the files a dir rule imported according to the lockfile
+func importedFromLock(rule config.Rule, lock *lockfile.Lockfile) ([]config.Rule, error) {
+	var imported []config.Rule
+	for _, locked := range lock.Rules {
+		if locked.From != rule.Name {
+			continue
+		}
+
+		file := config.Rule{}
+		if locked.Git != nil {
+			git := *locked.Git
+			if rule.Dir.Git != nil {
+				// The lockfile does not keep credentials
+				git.Repo = rule.Dir.Git.Repo
+			}
+			file.Git = &git
+		} else {
+			file.URL = withUserInfo(locked.URL, rule.Dir.URL)
+		}
+
+		entry := importedRule(rule, file)
+		entry.Name = locked.Name
+		imported = append(imported, entry)
+	}
+
+	if len(imported) == 0 {
+		return nil, fmt.Errorf("the files imported by rule '%s' are not recorded in %s; run 'currm pull' with network access first", rule.Name, lockfile.FileName)
+	}
+	return imported, nil
+}
+
+// importedRule returns the rule for a file imported by a dir rule.
+// The file has its path relative to the directory as name and its location set.
+func importedRule(rule config.Rule, file config.Rule) config.Rule {
+	return config.Rule{
+		Name:        importedName(rule.Name, file.Name),
+		URL:         file.URL,
+		Git:         file.Git,
+		Revision:    rule.Revision,
+		Description: rule.Description,
+		Globs:       rule.Globs,
+		AlwaysApply: rule.AlwaysApply,
+		From:        rule.Name,
+	}
+}
+
+// importedName derives the name of an imported rule from the name of the dir rule and the path of the file,
+// so that rules/go/style.mdc imported by "team" becomes "team-go-style"
+func importedName(prefix string, file string) string {
+	name := strings.Trim(strings.TrimSuffix(file, path.Ext(file)), "/")
+	name = strings.ReplaceAll(name, "/", "-")
+	if name == "" {
+		// A .cursorrules file directly in the directory
+		return prefix
+	}
+	return prefix + "-" + name
+}
+
+// importsFile reports whether a dir rule imports the file at the slash separated path relative to its directory
+func importsFile(dir *config.DirSource, file string) bool {
+	isRuleFile := false
+	for _, ext := range ruleFileExtensions {
+		if path.Ext(file) == ext {
+			isRuleFile = true
+		}
+	}
+	if !isRuleFile {
+		return false
+	}
+
+	included := len(dir.Include) == 0
+	for _, pattern := range dir.Include {
+		if matchPattern(pattern, file) {
+			included = true
+			break
+		}
+	}
+	for _, pattern := range dir.Exclude {
+		if matchPattern(pattern, file) {
+			return false
+		}
+	}
+	return included
+}
+
+// matchPattern reports whether the slash separated path matches the pattern.
+// "**" matches any number of directories, and a pattern without a slash matches the base name.
+func matchPattern(pattern string, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(file))
+		return ok
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(file, "/"))
+}
+
+// matchSegments matches the segments of a path against the segments of a pattern
+func matchSegments(pattern []string, file []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(file); i++ {
+				if matchSegments(pattern[1:], file[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(file) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], file[0]); !ok {
+			return false
+		}
+		pattern, file = pattern[1:], file[1:]
+	}
+	return len(file) == 0
+}
+
+// hasFrontMatter reports whether the content of a rule starts with YAML front matter
+func hasFrontMatter(content []byte) bool {
+	text := strings.TrimLeft(strings.TrimPrefix(string(content), "\xef\xbb\xbf"), " \t\r\n")
+	return strings.HasPrefix(text, "---\n") || strings.HasPrefix(text, "---\r\n")
+}
@@ -0,0 +1,253 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestImportsFile(t *testing.T) {
+	dir := &config.DirSource{Include: []string{"go/**", "*.cursorrules"}, Exclude: []string{"**/legacy/*", "draft-*"}}
+
+	tests := []struct {
+		file     string
+		expected bool
+	}{
+		{file: "go/style.mdc", expected: true},
+		{file: "go/nested/deep/style.mdc", expected: true},
+		{file: "python/.cursorrules", expected: true},
+		{file: "python/style.mdc", expected: false},
+		{file: "go/legacy/old.mdc", expected: false},
+		{file: "go/draft-new.mdc", expected: false},
+		{file: "go/README.md", expected: false},
+	}
+
+	for _, tt := range tests {
+		if actual := importsFile(dir, tt.file); actual != tt.expected {
+			t.Errorf("Import of '%s' does not match. Expected: %t, Actual: %t", tt.file, tt.expected, actual)
+		}
+	}
+
+	// Without include patterns every rule file is imported
+	if !importsFile(&config.DirSource{}, "any/where/rule.mdc") {
+		t.Error("Rule file was not imported without include patterns")
+	}
+}
+
+func TestImportedName(t *testing.T) {
+	tests := []struct {
+		prefix   string
+		file     string
+		expected string
+	}{
+		{prefix: "team", file: "go/style.mdc", expected: "team-go-style"},
+		{prefix: "team", file: "python/.cursorrules", expected: "team-python"},
+		{prefix: "team", file: ".cursorrules", expected: "team"},
+	}
+
+	for _, tt := range tests {
+		if actual := importedName(tt.prefix, tt.file); actual != tt.expected {
+			t.Errorf("Name does not match. Expected: %s, Actual: %s", tt.expected, actual)
+		}
+	}
+}
+
+func TestGitHubListDir(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/git/trees/v1" || r.URL.Query().Get("recursive") != "1" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`{"tree":[
+			{"path":"rules","type":"tree"},
+			{"path":"rules/go/style.mdc","type":"blob"},
+			{"path":"rules/python/.cursorrules","type":"blob"},
+			{"path":"docs/guide.mdc","type":"blob"}
+		],"truncated":false}`))
+	}))
+	defer server.Close()
+
+	req := &FetchRequest{
+		Rule:   config.Rule{Name: "team", URL: "https://github.com/owner/repo/tree/main/rules", Revision: "v1"},
+		Client: server.Client(),
+		Config: &config.Config{GitHubAPIURL: server.URL},
+	}
+	files, err := githubSource{}.ListDir(req)
+	if err != nil {
+		t.Fatalf("ListDir returned an error: %v", err)
+	}
+
+	// Files are linked at the ref of the directory URL; the revision of the rule is applied when they are fetched
+	expected := []string{
+		"go/style.mdc=https://github.com/owner/repo/blob/main/rules/go/style.mdc",
+		"python/.cursorrules=https://github.com/owner/repo/blob/main/rules/python/.cursorrules",
+	}
+	var actual []string
+	for _, file := range files {
+		actual = append(actual, file.Name+"="+file.URL)
+	}
+	if strings.Join(actual, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Files do not match. Expected: %v, Actual: %v", expected, actual)
+	}
+
+	req.Rule.URL = "https://github.com/owner"
+	if _, err := (githubSource{}).ListDir(req); err == nil {
+		t.Error("No error was returned for a URL that is not a directory")
+	}
+}
+
+func TestDownloadAllRulesDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "dir-rules-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a repository with a directory of rules
+	bareDir := filepath.Join(tempDir, "repo.git")
+	workDir := filepath.Join(tempDir, "work")
+	runGit(t, tempDir, "init", "--quiet", "--bare", "--initial-branch", "main", bareDir)
+	runGit(t, tempDir, "init", "--quiet", "--initial-branch", "main", workDir)
+	runGit(t, workDir, "remote", "add", "origin", bareDir)
+	files := map[string]string{
+		"rules/go/style.mdc":        "---\ndescription: Go style\nglobs: \"*.go\"\nalwaysApply: false\n---\n\nUse gofmt",
+		"rules/python/.cursorrules": "Use black",
+		"rules/shell.mdc":           "Quote variables",
+		"rules/legacy/old.mdc":      "Old rule",
+		"rules/README.md":           "Not a rule",
+		"other/ignored.mdc":         "Outside the directory",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(workDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "--quiet", "-m", "rules")
+	runGit(t, workDir, "push", "--quiet", "origin", "main")
+
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project directory: %v", err)
+	}
+
+	// Change to temporary directory
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{
+				Name:        "team",
+				Description: "Team rule",
+				Globs:       "*",
+				Dir: &config.DirSource{
+					Git:     &config.GitSource{Repo: "file://" + filepath.ToSlash(bareDir), Path: "rules"},
+					Exclude: []string{"legacy/**"},
+				},
+			},
+		},
+		Path: filepath.Join(projectDir, "currm.yaml"),
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	// Files keep their own front matter; files without one get the defaults of the dir rule
+	rulesDir := filepath.Join(projectDir, ".cursor", "rules")
+	expected := map[string]string{
+		"team-go-style.mdc": files["rules/go/style.mdc"],
+		"team-python.mdc":   "---\ndescription: Team rule\nglobs: *\nalwaysApply: false\n---\n\nUse black",
+		"team-shell.mdc":    "---\ndescription: Team rule\nglobs: *\nalwaysApply: false\n---\n\nQuote variables",
+	}
+	entries, err := os.ReadDir(rulesDir)
+	if err != nil {
+		t.Fatalf("Failed to read rules directory: %v", err)
+	}
+	if len(entries) != len(expected) {
+		t.Errorf("Number of installed rules does not match. Expected: %d, Actual: %d", len(expected), len(entries))
+	}
+	for name, content := range expected {
+		actual, err := os.ReadFile(filepath.Join(rulesDir, name))
+		if err != nil {
+			t.Errorf("Failed to read installed rule: %v", err)
+			continue
+		}
+		if string(actual) != content {
+			t.Errorf("Content of %s differs from expected. Expected: %q, Actual: %q", name, content, string(actual))
+		}
+	}
+
+	// The lockfile records every imported file and the rule it came from
+	lock, err := lockfile.Load(filepath.Join(projectDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if len(lock.Rules) != len(expected) {
+		t.Fatalf("Number of locked rules does not match. Expected: %d, Actual: %d", len(expected), len(lock.Rules))
+	}
+	for _, locked := range lock.Rules {
+		if locked.From != "team" || locked.Git == nil || !strings.HasPrefix(locked.Git.Path, "rules/") {
+			t.Errorf("Imported rule was not locked with its origin. Actual: %+v", locked)
+		}
+	}
+
+	// Every imported file is checked on its own
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	for _, status := range statuses {
+		if status.State != StateUpToDate {
+			t.Errorf("State of %s does not match. Expected: %s, Actual: %s", status.Name, StateUpToDate, status.State)
+		}
+	}
+
+	// A frozen install takes the imported files from the lockfile
+	os.RemoveAll(rulesDir)
+	if err := DownloadAllRules(cfg, Options{CacheDir: opts.CacheDir, Frozen: true}); err != nil {
+		t.Fatalf("Frozen install returned an error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rulesDir, "team-shell.mdc")); err != nil {
+		t.Errorf("Frozen install did not install the imported files: %v", err)
+	}
+
+	// A name clash between an imported file and another rule is an error
+	cfg.Rules = append(cfg.Rules, config.Rule{Name: "team-shell", Path: "shell.mdc"})
+	if err := DownloadAllRules(cfg, opts); err == nil {
+		t.Error("No error was returned for clashing rule names")
+	}
+
+	// Without a name, the imported rules could not be told apart from the others in the lockfile
+	cfg.Rules = []config.Rule{{Dir: cfg.Rules[0].Dir}, {Name: "team-shell", Path: "shell.mdc"}}
+	if err := DownloadAllRules(cfg, Options{CacheDir: opts.CacheDir, Frozen: true}); err == nil || !strings.Contains(err.Error(), "has no name") {
+		t.Errorf("No error was returned for a dir rule without a name: %v", err)
+	}
+}
@@ -1,53 +1,28 @@
 package downloader
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"time"
 
+	"github.com/guchey/currm/pkg/auth"
+	"github.com/guchey/currm/pkg/cache"
 	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/httpclient"
+	"github.com/guchey/currm/pkg/lockfile"
+	"github.com/guchey/currm/pkg/semver"
 )
 
-// getURLWithRevision returns the URL with the revision if specified
-func getURLWithRevision(rule config.Rule) string {
-	// If revision is not specified or is "latest", use the original URL
-	if rule.Revision == "" || rule.Revision == "latest" {
-		return rule.URL
-	}
-
-	// For GitHub URLs, apply the revision
-	if strings.Contains(rule.URL, "github.com") {
-		// For raw.githubusercontent.com URLs
-		if strings.Contains(rule.URL, "raw.githubusercontent.com") {
-			// URL format: https://raw.githubusercontent.com/owner/repo/branch/path/to/file
-			parts := strings.Split(rule.URL, "/")
-			if len(parts) >= 6 {
-				// Replace the branch part with the revision
-				parts[5] = rule.Revision
-				return strings.Join(parts, "/")
-			}
-		}
-
-		// For github.com URLs
-		if strings.Contains(rule.URL, "github.com") && !strings.Contains(rule.URL, "raw.githubusercontent.com") {
-			// URL format: https://github.com/owner/repo/blob/branch/path/to/file
-			parts := strings.Split(rule.URL, "/")
-			if len(parts) >= 7 && parts[5] == "blob" {
-				// Replace the branch part with the revision
-				parts[6] = rule.Revision
-				return strings.Join(parts, "/")
-			}
-		}
-	}
-
-	// For other URLs, use the original URL
-	return rule.URL
-}
-
 // getShortRevision returns a shortened version of the revision if it's a commit hash
 func getShortRevision(revision string) string {
 	// If it looks like a commit hash (40 hexadecimal characters), shorten it
@@ -67,208 +42,847 @@ func isHexString(s string) bool {
 	return true
 }
 
-// DownloadRule downloads the specified rule from the given URL and saves it to the rules directory
-func DownloadRule(rule config.Rule, rulesDir string) error {
-	// Get URL with revision consideration
-	url := getURLWithRevision(rule)
-
+// ruleFileName returns the name of the file the rule is saved as in the rules directory
+func ruleFileName(rule config.Rule) string {
 	// Use rule name as the base filename instead of extracting from URL
 	fileName := rule.Name + ".mdc"
 
-	// If revision is specified, add it to the filename
-	if rule.Revision != "" && rule.Revision != "latest" {
+	// If revision is specified, add it to the filename; version ranges float like "latest"
+	if rule.Revision != "" && rule.Revision != "latest" && !semver.IsConstraint(rule.Revision) {
 		fileExt := filepath.Ext(fileName)
 		fileBase := strings.TrimSuffix(fileName, fileExt)
-		shortRev := getShortRevision(rule.Revision)
+		// Branches such as feature/x would otherwise name a subdirectory
+		shortRev := strings.NewReplacer("/", "-", "\\", "-").Replace(getShortRevision(rule.Revision))
 		fileName = fmt.Sprintf("%s-%s%s", fileBase, shortRev, fileExt)
 	}
 
-	// Create the full path where the file will be saved
-	filePath := filepath.Join(rulesDir, fileName)
+	return fileName
+}
 
-	// Create and execute HTTP request to download the rule
-	resp, err := http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download rule '%s': %w", rule.Name, err)
+// resolvedCommit returns the commit the rule is pinned to, or an empty string if it is not known
+func resolvedCommit(rule config.Rule) string {
+	if len(rule.Revision) >= 40 && isHexString(rule.Revision) {
+		return rule.Revision
 	}
-	defer resp.Body.Close()
+	return ""
+}
+
+// sha256Hex returns the hex encoded SHA-256 of the content
+func sha256Hex(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
 
-	// Verify the HTTP response status code
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("failed to download rule '%s': HTTP status code %d", rule.Name, resp.StatusCode)
+// IntegrityError is returned when fetched content does not match the sha256 pinned in the configuration
+type IntegrityError struct {
+	Rule     string
+	Expected string
+	Actual   string
+}
+
+func (e *IntegrityError) Error() string {
+	return fmt.Sprintf("integrity check failed for rule '%s': expected sha256 %s, got %s", e.Rule, e.Expected, e.Actual)
+}
+
+// verifyIntegrity checks the fetched content against the sha256 pinned in the rule, if any
+func verifyIntegrity(rule config.Rule, content []byte) error {
+	if rule.SHA256 == "" {
+		return nil
 	}
 
-	// Read the content from the response
-	content, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read content for rule '%s': %w", rule.Name, err)
+	actual := sha256Hex(content)
+	if !strings.EqualFold(actual, rule.SHA256) {
+		return &IntegrityError{Rule: rule.Name, Expected: strings.ToLower(rule.SHA256), Actual: actual}
 	}
+	return nil
+}
 
+// renderRule returns the bytes that are written to the rules directory for the fetched content
+func renderRule(rule config.Rule, url string, content []byte) []byte {
 	// If the URL ends with .cursorrules, convert it to .mdc format
 	isCursorRules := strings.HasSuffix(url, ".cursorrules")
-	if isCursorRules {
-		// Get description from rule or use name as fallback
-		description := rule.Description
-		if description == "" {
-			description = rule.Name
-		}
+	// Files imported from a directory get the front matter defaults of their dir rule if they have none
+	needsFrontMatter := rule.From != "" && !hasFrontMatter(content)
+	if !isCursorRules && !needsFrontMatter {
+		return content
+	}
 
-		// Get globs from rule or use "*" as default
-		globs := rule.Globs
-		if globs == "" {
-			globs = "*"
-		}
+	// Get description from rule or use name as fallback
+	description := rule.Description
+	if description == "" {
+		description = rule.Name
+	}
+
+	// Get globs from rule or use "*" as default
+	globs := rule.Globs
+	if globs == "" {
+		globs = "*"
+	}
+
+	// Get alwaysApply from rule
+	alwaysApply := rule.AlwaysApply
+
+	// Create the .mdc format with YAML front matter
+	mdcContent := fmt.Sprintf("---\ndescription: %s\nglobs: %s\nalwaysApply: %t\n---\n\n%s",
+		description,
+		globs,
+		alwaysApply,
+		string(content))
+	return []byte(mdcContent)
+}
+
+// installResult describes a rule that was written to the rules directory
+type installResult struct {
+	Path           string
+	ResolvedURL    string
+	ResolvedCommit string
+	// ResolvedRevision is the tag a version range resolved to
+	ResolvedRevision string
+	SHA256           string
+	FetchedAt        time.Time
+	// Unchanged is set when the installed content is still current, as reported by the server or found on disk
+	Unchanged bool
+	// staged is the file the content was written to in the staging directory; it is moved to Path on commit
+	staged string
+}
 
-		// Get alwaysApply from rule
-		alwaysApply := rule.AlwaysApply
+// runner holds the state shared by all rules processed by a command
+type runner struct {
+	client     *http.Client
+	cache      *cache.Cache // nil disables conditional requests
+	config     *config.Config
+	configPath string
+	configDir  string // local rules are resolved relative to this directory
+	rulesDir   string
+	offline    bool   // install from the rule store only
+	stageDir   string // rules are written here and moved into the rules directory on commit, if set
+	// providers maps the hosts of self-hosted providers to their sources
+	providers map[string]Source
+	commits   *commitCache // refs resolved by providers during the run
+}
+
+// newRunner creates a runner for the configuration and options
+func newRunner(cfg *config.Config, opts Options, rulesDir string) (*runner, error) {
+	client, err := newClient(cfg, opts)
+	if err != nil {
+		return nil, err
+	}
 
-		// Create the .mdc format with YAML front matter
-		mdcContent := fmt.Sprintf("---\ndescription: %s\nglobs: %s\nalwaysApply: %t\n---\n\n%s",
-			description,
-			globs,
-			alwaysApply,
-			string(content))
-		content = []byte(mdcContent)
+	// The cache only saves requests, so run without it if there is no cache directory
+	c, _ := cache.Open()
+	if opts.CacheDir != "" {
+		c = cache.New(opts.CacheDir)
 	}
 
-	// Create the destination file
-	file, err := os.Create(filePath)
+	if opts.Offline && c == nil {
+		return nil, fmt.Errorf("offline mode requires a cache directory; set CURRM_CACHE_DIR")
+	}
+
+	providers, err := providerHosts(cfg.Providers)
 	if err != nil {
-		return fmt.Errorf("failed to create file '%s': %w", filePath, err)
+		return nil, err
 	}
-	defer file.Close()
 
-	// Write the content to the file
-	_, err = file.Write(content)
+	return &runner{
+		client:     client,
+		cache:      c,
+		config:     cfg,
+		configPath: cfg.Path,
+		configDir:  filepath.Dir(cfg.Path),
+		rulesDir:   rulesDir,
+		offline:    opts.Offline,
+		providers:  providers,
+		commits:    &commitCache{},
+	}, nil
+}
+
+// target is where a rule is fetched from
+type target struct {
+	source   Source
+	location string
+	// rule is the rule with a version range revision replaced by the tag it resolved to
+	rule config.Rule
+	// tag is the tag a version range resolved to; it is empty for other revisions
+	tag string
+	// newer is the highest release tag of the repository if it is above the range, such as a new major version
+	newer string
+}
+
+// resolve returns the source of the rule and the location it is fetched from.
+// Hosts of self-hosted providers in the configuration take precedence over the registered sources.
+// A version range revision is resolved to lockedTag if given, otherwise to the highest tag in range.
+func (r *runner) resolve(rule config.Rule, lockedTag string) (*target, error) {
+	source, err := r.lookup(rule)
 	if err != nil {
-		return fmt.Errorf("failed to write to file '%s': %w", filePath, err)
+		return nil, err
 	}
 
-	fmt.Printf("Downloaded rule '%s' to '%s'\n", rule.Name, filePath)
-	return nil
+	t := &target{source: source, rule: rule}
+	if semver.IsConstraint(rule.Revision) {
+		if err := r.resolveRange(t, lockedTag); err != nil {
+			return nil, err
+		}
+	}
+
+	t.location, err = source.Resolve(t.rule)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
 }
 
-// DownloadAllRules downloads all rules specified in the configuration file
-// It continues downloading even if some rules fail to download
-func DownloadAllRules(cfg *config.Config) error {
-	// Get the directory where rules should be stored
-	rulesDir, err := config.GetRulesDir()
+// resolveRange replaces the version range revision of the target rule with a tag of its repository
+func (r *runner) resolveRange(t *target, lockedTag string) error {
+	rule := t.rule
+	constraint, err := semver.ParseConstraint(rule.Revision)
 	if err != nil {
-		return err
+		return fmt.Errorf("invalid revision of rule '%s': %w", rule.Name, err)
+	}
+	if rule.Git != nil && rule.Git.Ref != "" {
+		return fmt.Errorf("rule '%s' sets both git.ref and the version range '%s'; use only one", rule.Name, rule.Revision)
 	}
 
-	fmt.Printf("Downloading rules to '%s'\n", rulesDir)
+	if lockedTag != "" {
+		t.tag = lockedTag
+	} else {
+		if r.offline {
+			return fmt.Errorf("version range '%s' of rule '%s' cannot be resolved offline: it has never been fetched; run 'currm pull' with network access first", rule.Revision, rule.Name)
+		}
 
-	// Download each rule defined in the configuration
-	for _, rule := range cfg.Rules {
-		if err := DownloadRule(rule, rulesDir); err != nil {
-			fmt.Printf("Warning: %v\n", err)
-			// Continue with the next rule even if this one failed
-			continue
+		lister, ok := t.source.(TagLister)
+		if !ok {
+			return fmt.Errorf("version range '%s' of rule '%s' cannot be resolved: the tags of its repository cannot be listed; use a GitHub URL or a git source", rule.Revision, rule.Name)
+		}
+		tags, err := lister.Tags(r.request(rule, "", nil))
+		if err != nil {
+			return err
+		}
+
+		highest := constraint.Highest(tags)
+		if highest == nil {
+			return fmt.Errorf("no tag of rule '%s' matches version range '%s'", rule.Name, rule.Revision)
+		}
+		t.tag = highest.Original
+		if latest := semver.Latest(tags); latest != nil && latest.Compare(highest) > 0 && !constraint.Check(latest) {
+			t.newer = latest.Original
 		}
 	}
 
+	t.rule.Revision = t.tag
 	return nil
 }
 
-// RuleStatus represents the status of a rule
-type RuleStatus struct {
-	Name           string
-	LocalPath      string
-	HasLocalFile   bool
-	NeedsUpdate    bool
-	LastModified   time.Time
-	RemoteModified time.Time
-	Revision       string
+// lookup returns the source of the rule
+func (r *runner) lookup(rule config.Rule) (Source, error) {
+	if rule.Git == nil && rule.Path == "" && len(r.providers) > 0 {
+		if u, err := url.Parse(rule.URL); err == nil {
+			if source, ok := r.providers[strings.ToLower(u.Host)]; ok {
+				return source, nil
+			}
+			if source, ok := r.providers[strings.ToLower(u.Hostname())]; ok {
+				return source, nil
+			}
+		}
+	}
+	return LookupSource(rule)
+}
+
+// validators returns the cached validators for the rule fetched from url, or nil if there are none
+func (r *runner) validators(rule config.Rule, url string) *cache.Validators {
+	if r.cache == nil {
+		return nil
+	}
+
+	validators, err := r.cache.LoadValidators(cache.ValidatorsKey(r.configPath, rule.Name, url))
+	if err != nil || validators == nil || validators.URL != auth.Redact(url) {
+		return nil
+	}
+	return validators
+}
+
+// request returns the fetch request for the rule at location
+func (r *runner) request(rule config.Rule, location string, validators *cache.Validators) *FetchRequest {
+	req := &FetchRequest{
+		Rule:       rule,
+		Location:   location,
+		Client:     r.client,
+		Config:     r.config,
+		ConfigDir:  r.configDir,
+		Validators: validators,
+		commits:    r.commits,
+	}
+	if r.cache != nil {
+		req.CacheDir = r.cache.Dir()
+	}
+	return req
 }
 
-// CheckRuleUpdates checks if any rules need to be updated
-func CheckRuleUpdates(cfg *config.Config) ([]RuleStatus, error) {
-	// Get the directory where rules are stored
-	rulesDir, err := config.GetRulesDir()
+// install fetches the rule from the target and writes it to the rules directory.
+// If revision is not empty, it is fetched instead of the configured ref.
+// If expectedSHA256 is not empty, the rendered content must match it or nothing is written.
+func (r *runner) install(rule config.Rule, t *target, revision string, expectedSHA256 string) (*installResult, error) {
+	// The file is named after the configured rule, so a version range keeps its file when the tag moves
+	filePath, err := rulePath(r.rulesDir, rule)
 	if err != nil {
 		return nil, err
 	}
+	result, err := r.fetchInstall(t.rule, t.source, t.location, filePath, revision, expectedSHA256)
+	if err != nil {
+		return nil, err
+	}
+	result.ResolvedRevision = t.tag
+	return result, nil
+}
 
-	var statuses []RuleStatus
+// fetchInstall fetches the rule from location using source and writes it to filePath
+func (r *runner) fetchInstall(rule config.Rule, source Source, location string, filePath string, revision string, expectedSHA256 string) (*installResult, error) {
 
-	// Check each rule defined in the configuration
-	for _, rule := range cfg.Rules {
-		// Get URL with revision consideration
-		url := getURLWithRevision(rule)
+	// Local rules are always read from disk, also in offline mode
+	if _, local := source.(localSource); r.offline && !local {
+		return r.installFrom(rule, location, filePath, expectedSHA256, nil)
+	}
 
-		// Use rule name as the base filename
-		fileName := rule.Name + ".mdc"
+	// Only ask whether the content changed if the installed file is still what was written last time
+	var validators *cache.Validators
+	if expectedSHA256 == "" {
+		validators = r.validators(rule, location)
+		if validators != nil {
+			installed, err := os.ReadFile(filePath)
+			if err != nil || sha256Hex(installed) != validators.InstalledSHA256 {
+				validators = nil
+			}
+		}
+	}
 
-		// If revision is specified, add it to the filename
-		if rule.Revision != "" && rule.Revision != "latest" {
-			fileExt := filepath.Ext(fileName)
-			fileBase := strings.TrimSuffix(fileName, fileExt)
-			shortRev := getShortRevision(rule.Revision)
-			fileName = fmt.Sprintf("%s-%s%s", fileBase, shortRev, fileExt)
+	req := r.request(rule, location, validators)
+	req.Revision = revision
+	resp, err := source.Fetch(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.NotModified && validators != nil {
+		if rule.SHA256 != "" && !strings.EqualFold(validators.ContentSHA256, rule.SHA256) {
+			return nil, &IntegrityError{Rule: rule.Name, Expected: strings.ToLower(rule.SHA256), Actual: validators.ContentSHA256}
 		}
+		commit := resolvedCommit(rule)
+		if resp.Revision != "" {
+			commit = resp.Revision
+		}
+		return &installResult{
+			Path:           filePath,
+			ResolvedURL:    location,
+			ResolvedCommit: commit,
+			SHA256:         validators.InstalledSHA256,
+			FetchedAt:      validators.FetchedAt,
+			Unchanged:      true,
+		}, nil
+	}
 
-		// Create the full path where the file should be
-		filePath := filepath.Join(rulesDir, fileName)
+	return r.installFrom(rule, location, filePath, expectedSHA256, resp)
+}
 
-		status := RuleStatus{
-			Name:      rule.Name,
-			LocalPath: filePath,
-			Revision:  rule.Revision,
+// installFrom writes the fetched content to filePath, taking it from the rule store when resp is nil
+func (r *runner) installFrom(rule config.Rule, location string, filePath string, expectedSHA256 string, resp *FetchResult) (*installResult, error) {
+	// The name decides whether the content is converted
+	name := location
+	commit := resolvedCommit(rule)
+	var content []byte
+	var fetchedAt time.Time
+	if resp == nil {
+		stored, entry, err := r.cache.Get(auth.Redact(location), rule.Revision)
+		if errors.Is(err, cache.ErrNotCached) {
+			return nil, fmt.Errorf("rule '%s' is not available offline: it has never been fetched; run 'currm pull' with network access first", rule.Name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read rule '%s' from the rule store: %w", rule.Name, err)
+		}
+		content, fetchedAt = stored, entry.FetchedAt
+		// Branches, tags and ranges only tell their commit when they are fetched
+		if entry.Commit != "" {
+			commit = entry.Commit
+		}
+	} else {
+		content, fetchedAt = resp.Content, time.Now().UTC()
+		if resp.Revision != "" {
+			commit = resp.Revision
+		}
+		if resp.Path != "" {
+			name = resp.Path
 		}
 
-		// Check if the file exists locally
-		fileInfo, err := os.Stat(filePath)
-		if err == nil {
-			status.HasLocalFile = true
-			status.LastModified = fileInfo.ModTime()
-		} else if os.IsNotExist(err) {
-			status.HasLocalFile = false
-		} else {
-			return nil, fmt.Errorf("failed to check file '%s': %w", filePath, err)
+		// Keep every fetched body so that it can be installed offline later; local files are always available
+		if r.cache != nil && resp.Path == "" {
+			r.cache.Put(auth.Redact(location), rule.Revision, commit, content, fetchedAt)
 		}
+	}
 
-		// If a specific revision is specified and the file exists, no update is needed
-		if rule.Revision != "" && rule.Revision != "latest" && status.HasLocalFile {
-			status.NeedsUpdate = false
-			statuses = append(statuses, status)
-			continue
+	// Verify the pinned hash against the fetched bytes before any conversion
+	if err := verifyIntegrity(rule, content); err != nil {
+		return nil, err
+	}
+	contentSHA256 := sha256Hex(content)
+
+	content = renderRule(rule, name, content)
+	digest := sha256Hex(content)
+	if expectedSHA256 != "" && digest != expectedSHA256 {
+		return nil, fmt.Errorf("content of rule '%s' does not match the lockfile: expected sha256 %s, got %s", rule.Name, expectedSHA256, digest)
+	}
+
+	// Stage the file for the transaction of the install, or replace the installed file at once.
+	// A file that already has the content is left alone, so that an install without changes keeps the previous backup.
+	staged := ""
+	unchanged := false
+	if installed, err := os.ReadFile(filePath); err == nil && sha256Hex(installed) == digest {
+		unchanged = true
+	} else if r.stageDir != "" {
+		staged = filepath.Join(r.stageDir, filepath.Base(filePath))
+		if err := os.WriteFile(staged, content, 0644); err != nil {
+			return nil, fmt.Errorf("failed to stage file '%s': %w", filePath, err)
 		}
+	} else if err := writeFileAtomic(filePath, content); err != nil {
+		return nil, err
+	}
+
+	// Remember the validators so that the next run can send a conditional request
+	if r.cache != nil && resp != nil && (resp.ETag != "" || resp.LastModified != "") {
+		r.cache.SaveValidators(cache.ValidatorsKey(r.configPath, rule.Name, location), cache.Validators{
+			URL:             auth.Redact(location),
+			ETag:            resp.ETag,
+			LastModified:    resp.LastModified,
+			ContentSHA256:   contentSHA256,
+			InstalledSHA256: digest,
+			FetchedAt:       fetchedAt,
+		})
+	}
+
+	return &installResult{
+		Path:           filePath,
+		ResolvedURL:    location,
+		ResolvedCommit: commit,
+		SHA256:         digest,
+		FetchedAt:      fetchedAt,
+		Unchanged:      unchanged,
+		staged:         staged,
+	}, nil
+}
+
+// reportInstalled prints the outcome of a successful install
+func reportInstalled(rule config.Rule, result *installResult) {
+	if result.Unchanged {
+		fmt.Printf("Rule '%s' is up to date at '%s'\n", rule.Name, result.Path)
+		return
+	}
+	fmt.Printf("Downloaded rule '%s' to '%s'\n", rule.Name, result.Path)
+}
+
+// DownloadRule downloads the specified rule from the given URL and saves it to the rules directory
+func DownloadRule(rule config.Rule, rulesDir string) error {
+	r, err := newRunner(&config.Config{}, Options{}, rulesDir)
+	if err != nil {
+		return err
+	}
 
-		// Check remote file
-		req, err := http.NewRequest("HEAD", url, nil)
+	t, err := r.resolve(rule, "")
+	if err != nil {
+		return err
+	}
+
+	result, err := r.install(rule, t, "", "")
+	if err != nil {
+		return err
+	}
+
+	reportInstalled(rule, result)
+	return nil
+}
+
+// FetchRule fetches a rule without installing it and returns the content that would be installed.
+// It is used to check that a rule can be fetched before it is added to the configuration.
+func FetchRule(cfg *config.Config, rule config.Rule, opts Options) ([]byte, error) {
+	r, err := newRunner(cfg, opts, "")
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := r.resolve(rule, "")
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := t.source.Fetch(r.request(t.rule, t.location, nil))
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyIntegrity(rule, resp.Content); err != nil {
+		return nil, err
+	}
+
+	name := t.location
+	if resp.Path != "" {
+		name = resp.Path
+	}
+	return renderRule(rule, name, resp.Content), nil
+}
+
+// Options controls how DownloadAllRules installs rules
+type Options struct {
+	// Frozen installs exactly what the lockfile records and fails if it disagrees with the configuration
+	Frozen bool
+	// Jobs is the number of rules processed at once; it overrides the configuration when greater than zero
+	Jobs int
+	// PerHostJobs limits the rules fetched from the same host at once; it overrides the configuration when greater than zero
+	PerHostJobs int
+	// Client is used for all requests; when nil, a client is built from the HTTP settings of the configuration
+	Client *http.Client
+	// Auth resolves the credentials sent to each host; when nil, they are loaded from the environment and user files.
+	// It is not used when Client is set.
+	Auth *auth.Resolver
+	// CacheDir overrides the directory HTTP validators and fetched rules are cached in
+	CacheDir string
+	// Offline installs rules from the rule store without using the network
+	Offline bool
+	// Prune deletes files installed for rules that were removed from the configuration or renamed by a new revision
+	Prune bool
+	// KeepGoing installs every rule that can be installed even if others fail; the failures are still returned.
+	// Frozen installs install nothing regardless.
+	KeepGoing bool
+	// FailFast stops installing rules after the first failure
+	FailFast bool
+	// Rules limits the install to the named rules; the lockfile keeps the entries of the others.
+	// A dir rule selects every rule it imports.
+	Rules []string
+}
+
+// newClient returns the HTTP client to use for the configuration and options
+func newClient(cfg *config.Config, opts Options) (*http.Client, error) {
+	if opts.Client != nil {
+		return opts.Client, nil
+	}
+
+	resolver := opts.Auth
+	if resolver == nil {
+		var err error
+		if resolver, err = auth.Load(); err != nil {
+			return nil, err
+		}
+	}
+
+	settings := httpclient.FromConfig(cfg.HTTP)
+	settings.Transport = &auth.Transport{Base: http.DefaultTransport, Resolver: resolver}
+	return httpclient.New(settings), nil
+}
+
+// installOutcome holds the result of installing a single rule
+type installOutcome struct {
+	result *installResult
+	err    error
+}
+
+// installAll calls install for every rule in parallel and returns the outcomes in configuration order.
+// In fail-fast mode, rules that have not started when a rule fails are skipped.
+func (r *runner) installAll(cfg *config.Config, opts Options, install func(rule config.Rule) (*installResult, error)) []installOutcome {
+	outcomes := make([]installOutcome, len(cfg.Rules))
+	var failed atomic.Bool
+	r.forEachRule(cfg, opts, func(i int, rule config.Rule) {
+		if opts.FailFast && failed.Load() {
+			outcomes[i] = installOutcome{err: ErrSkipped}
+			return
+		}
+
+		result, err := install(rule)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create request for rule '%s': %w", rule.Name, err)
+			failed.Store(true)
 		}
+		outcomes[i] = installOutcome{result: result, err: err}
+	})
+	return outcomes
+}
+
+// DownloadAllRules downloads all rules specified in the configuration file and records them in the lockfile.
+// It continues downloading even if some rules fail to download, unless opts.FailFast is set.
+// The rules are staged and only replace the installed files if all of them succeed, or each one that succeeds
+// when opts.KeepGoing is set. Failures are returned as a *PullError in either case.
+func DownloadAllRules(cfg *config.Config, opts Options) error {
+	if opts.KeepGoing && opts.FailFast {
+		return fmt.Errorf("keep-going and fail-fast cannot be used together")
+	}
+
+	// Get the directory where rules should be stored
+	rulesDir, err := projectRulesDir()
+	if err != nil {
+		return err
+	}
 
-		resp, err := http.DefaultClient.Do(req)
+	lockPath := lockfile.PathFor(cfg.Path)
+	if opts.Frozen {
+		if opts.Prune {
+			return fmt.Errorf("pruning is not possible in a frozen install, which does not change %s", lockfile.FileName)
+		}
+		return downloadFrozen(cfg, opts, rulesDir, lockPath)
+	}
+
+	// Keep entries of rules that fail this time so the lockfile does not lose them
+	previous, err := lockfile.Load(lockPath)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		previous = lockfile.New()
+	}
+
+	fmt.Printf("Downloading rules to '%s'\n", rulesDir)
+
+	r, err := newRunner(cfg, opts, rulesDir)
+	if err != nil {
+		return err
+	}
+
+	// Dir rules are replaced by the files they import; offline, those are the files imported last time
+	cfg, err = r.expandRules(cfg, previous, opts.Offline)
+	if err != nil {
+		return err
+	}
+	configured := cfg.Rules
+	if len(opts.Rules) > 0 {
+		if cfg, err = selectRules(cfg, opts.Rules); err != nil {
+			return err
+		}
+	}
+
+	tx, err := beginTransaction(rulesDir)
+	if err != nil {
+		return err
+	}
+	defer tx.close()
+	r.stageDir = tx.stageDir
+
+	// Download each rule defined in the configuration
+	outcomes := r.installAll(cfg, opts, func(rule config.Rule) (*installResult, error) {
+		// Offline, a version range can only be installed at the tag it resolved to last time
+		lockedTag := ""
+		if locked := previous.Find(rule.Name); opts.Offline && locked != nil && lockMatchesRule(*locked, rule) {
+			lockedTag = locked.ResolvedRevision
+		}
+
+		t, err := r.resolve(rule, lockedTag)
 		if err != nil {
-			return nil, fmt.Errorf("failed to check rule '%s': %w", rule.Name, err)
+			return nil, err
+		}
+		return r.install(rule, t, "", "")
+	})
+
+	// Without keep-going, a single failure leaves the installed rules and the lockfile as they were
+	failures := collectFailures(cfg.Rules, outcomes)
+	if failures != nil && !opts.KeepGoing {
+		printSummary(cfg.Rules, outcomes, false)
+		fmt.Println("Use --keep-going to install the rules that succeeded")
+		return failures
+	}
+	if err := tx.commit(lockPath, successfulResults(outcomes)); err != nil {
+		return err
+	}
+
+	// Report the results in configuration order
+	installed := make(map[string]int)
+	for i, rule := range cfg.Rules {
+		installed[rule.Name] = i
+	}
+	lock := lockfile.New()
+	for _, rule := range configured {
+		i, ok := installed[rule.Name]
+		if !ok || outcomes[i].err != nil {
+			// Failures are listed in the summary; keep the entries of failed and unselected rules so the lockfile does not lose them
+			if locked := previous.Find(rule.Name); locked != nil && lockMatchesRule(*locked, rule) {
+				lock.Rules = append(lock.Rules, *locked)
+			}
+			// Continue with the next rule even if this one failed
+			continue
 		}
-		resp.Body.Close()
+		result := outcomes[i].result
+
+		reportInstalled(rule, result)
+		lock.Rules = append(lock.Rules, lockfile.LockedRule{
+			Name:             rule.Name,
+			URL:              auth.Redact(rule.URL),
+			Path:             filepath.ToSlash(rule.Path),
+			Git:              redactGitSource(rule.Git),
+			Revision:         rule.Revision,
+			From:             rule.From,
+			File:             filepath.Base(result.Path),
+			ResolvedURL:      auth.Redact(result.ResolvedURL),
+			ResolvedRevision: result.ResolvedRevision,
+			ResolvedCommit:   result.ResolvedCommit,
+			SHA256:           result.SHA256,
+			FetchedAt:        result.FetchedAt,
+		})
+	}
+
+	// Files of removed rules stay tracked until they are pruned, so that hand-written rules are never deleted
+	lock.Orphaned = pruneFiles(rulesDir, orphanedFiles(previous, lock), opts.Prune, tx)
+
+	if err := lock.Save(lockPath); err != nil {
+		return err
+	}
+	if err := tx.finish(); err != nil {
+		return err
+	}
+
+	if failures != nil {
+		printSummary(cfg.Rules, outcomes, true)
+		return failures
+	}
+	return nil
+}
+
+// selectRules returns the configuration with only the named rules and the rules imported by named dir rules
+func selectRules(cfg *config.Config, names []string) (*config.Config, error) {
+	wanted := make(map[string]bool)
+	for _, name := range names {
+		wanted[name] = true
+	}
 
-		if resp.StatusCode != http.StatusOK {
-			return nil, fmt.Errorf("failed to check rule '%s': HTTP status code %d", rule.Name, resp.StatusCode)
+	selected := *cfg
+	selected.Rules = nil
+	found := make(map[string]bool)
+	for _, rule := range cfg.Rules {
+		switch {
+		case wanted[rule.Name]:
+			found[rule.Name] = true
+		case rule.From != "" && wanted[rule.From]:
+			found[rule.From] = true
+		default:
+			continue
 		}
+		selected.Rules = append(selected.Rules, rule)
+	}
 
-		// Get last modified time from header if available
-		lastModHeader := resp.Header.Get("Last-Modified")
-		if lastModHeader != "" {
-			remoteTime, err := time.Parse(time.RFC1123, lastModHeader)
-			if err == nil {
-				status.RemoteModified = remoteTime
-				// Check if remote file is newer than local file
-				if !status.HasLocalFile || remoteTime.After(status.LastModified) {
-					status.NeedsUpdate = true
-				}
+	for _, name := range names {
+		if !found[name] {
+			return nil, fmt.Errorf("rule '%s' is not in the configuration", name)
+		}
+	}
+	return &selected, nil
+}
+
+// successfulResults returns the results of the rules that were installed
+func successfulResults(outcomes []installOutcome) []*installResult {
+	var results []*installResult
+	for _, outcome := range outcomes {
+		if outcome.err == nil {
+			results = append(results, outcome.result)
+		}
+	}
+	return results
+}
+
+// lockMatchesRule reports whether the locked entry was produced from the same rule definition
+func lockMatchesRule(locked lockfile.LockedRule, rule config.Rule) bool {
+	return locked.Name == rule.Name && locked.From == rule.From && locked.URL == auth.Redact(rule.URL) &&
+		locked.Path == filepath.ToSlash(rule.Path) && locked.Revision == rule.Revision &&
+		reflect.DeepEqual(locked.Git, redactGitSource(rule.Git))
+}
+
+// verifyLock checks that the lockfile covers exactly the rules in the configuration
+func verifyLock(cfg *config.Config, lock *lockfile.Lockfile) error {
+	for _, rule := range cfg.Rules {
+		locked := lock.Find(rule.Name)
+		if locked == nil {
+			return fmt.Errorf("currm.yaml and %s disagree: rule '%s' is not locked; run 'currm pull' to update the lockfile", lockfile.FileName, rule.Name)
+		}
+		if !lockMatchesRule(*locked, rule) {
+			return fmt.Errorf("currm.yaml and %s disagree: rule '%s' has changed; run 'currm pull' to update the lockfile", lockfile.FileName, rule.Name)
+		}
+	}
+
+	for _, locked := range lock.Rules {
+		found := false
+		for _, rule := range cfg.Rules {
+			if rule.Name == locked.Name {
+				found = true
+				break
 			}
-		} else {
-			// If no Last-Modified header, assume update is needed if file doesn't exist
-			status.NeedsUpdate = !status.HasLocalFile
 		}
+		if !found {
+			return fmt.Errorf("currm.yaml and %s disagree: rule '%s' is no longer configured; run 'currm pull' to update the lockfile", lockfile.FileName, locked.Name)
+		}
+	}
 
-		statuses = append(statuses, status)
+	return nil
+}
+
+// withUserInfo restores the user information of the configured URL that was redacted from the locked URL
+func withUserInfo(lockedURL, configuredURL string) string {
+	configured, err := url.Parse(configuredURL)
+	if err != nil || configured.User == nil {
+		return lockedURL
+	}
+	locked, err := url.Parse(lockedURL)
+	if err != nil || locked.Host != configured.Host {
+		return lockedURL
+	}
+	locked.User = configured.User
+	return locked.String()
+}
+
+// downloadFrozen installs exactly the content recorded in the lockfile
+func downloadFrozen(cfg *config.Config, opts Options, rulesDir string, lockPath string) error {
+	lock, err := lockfile.Load(lockPath)
+	if err != nil {
+		return fmt.Errorf("frozen install requires a lockfile: %w", err)
+	}
+
+	r, err := newRunner(cfg, opts, rulesDir)
+	if err != nil {
+		return err
+	}
+
+	// Dir rules install exactly the files that were imported when the lockfile was written
+	cfg, err = r.expandRules(cfg, lock, true)
+	if err != nil {
+		return err
+	}
+
+	if err := verifyLock(cfg, lock); err != nil {
+		return err
 	}
 
-	return statuses, nil
+	fmt.Printf("Installing locked rules to '%s'\n", rulesDir)
+
+	tx, err := beginTransaction(rulesDir)
+	if err != nil {
+		return err
+	}
+	defer tx.close()
+	r.stageDir = tx.stageDir
+
+	outcomes := r.installAll(cfg, opts, func(rule config.Rule) (*installResult, error) {
+		locked := lock.Find(rule.Name)
+
+		// Version ranges stay at the tag that was locked
+		t, err := r.resolve(rule, locked.ResolvedRevision)
+		if err != nil {
+			return nil, err
+		}
+		if rule.Git == nil {
+			t.location = withUserInfo(locked.ResolvedURL, rule.URL)
+		}
+
+		// Sources that resolve refs fetch the commit that was locked rather than the current one
+		return r.install(rule, t, locked.ResolvedCommit, locked.SHA256)
+	})
+
+	// A frozen install must reproduce the lockfile completely
+	if failures := collectFailures(cfg.Rules, outcomes); failures != nil {
+		printSummary(cfg.Rules, outcomes, false)
+		return failures
+	}
+	if err := tx.commit(lockPath, successfulResults(outcomes)); err != nil {
+		return err
+	}
+
+	for i, rule := range cfg.Rules {
+		reportInstalled(rule, outcomes[i].result)
+	}
+	return tx.finish()
 }
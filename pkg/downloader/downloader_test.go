@@ -1,14 +1,21 @@
 package downloader
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/guchey/currm/pkg/auth"
 	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
 )
 
 func TestDownloadRule(t *testing.T) {
@@ -131,10 +138,19 @@ func TestDownloadAllRules(t *testing.T) {
 		},
 	}
 
-	// Execute the function under test
-	err = DownloadAllRules(cfg)
-	if err != nil {
-		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	// Execute the function under test; the failing rule is reported after the others were installed
+	err = DownloadAllRules(cfg, Options{})
+	var pullErr *PullError
+	if !errors.As(err, &pullErr) {
+		t.Fatalf("DownloadAllRules function did not return a PullError: %v", err)
+	}
+	if len(pullErr.Failures) != 1 || pullErr.Failures[0].Rule != "Error Rule" || pullErr.Total != 3 {
+		t.Errorf("Failures differ from expected. Actual: %+v", pullErr)
+	}
+
+	// With keep-going, the other rules are installed and the failure is still returned
+	if err := DownloadAllRules(cfg, Options{KeepGoing: true}); !errors.As(err, &pullErr) {
+		t.Errorf("DownloadAllRules function did not return a PullError with keep-going: %v", err)
 	}
 
 	// Get rules directory path
@@ -284,3 +300,379 @@ func TestDownloadRuleWithCursorRules(t *testing.T) {
 		})
 	}
 }
+
+func TestDownloadAllRulesLockfile(t *testing.T) {
+	content := "Locked rule content"
+
+	// Create HTTP test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rule":
+			w.WriteHeader(http.StatusOK)
+			w.Write([]byte(content))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "lockfile-rules-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "locked", URL: server.URL + "/rule"},
+		},
+		Path: filepath.Join(tempDir, "currm.yaml"),
+	}
+
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	// Check that the lockfile records the written content
+	lock, err := lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	locked := lock.Find("locked")
+	if locked == nil {
+		t.Fatal("Rule was not recorded in the lockfile")
+	}
+	sum := sha256.Sum256([]byte(content))
+	if locked.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Locked SHA-256 differs from expected. Expected: %s, Actual: %s", hex.EncodeToString(sum[:]), locked.SHA256)
+	}
+	if locked.ResolvedURL != server.URL+"/rule" {
+		t.Errorf("Locked URL differs from expected. Expected: %s, Actual: %s", server.URL+"/rule", locked.ResolvedURL)
+	}
+
+	// A frozen install succeeds while the remote content is unchanged
+	if err := DownloadAllRules(cfg, Options{Frozen: true}); err != nil {
+		t.Errorf("Frozen install returned an error: %v", err)
+	}
+
+	// A frozen install fails once the remote content drifts from the lockfile
+	content = "Changed rule content"
+	if err := DownloadAllRules(cfg, Options{Frozen: true}); err == nil {
+		t.Error("No error was returned for content that does not match the lockfile")
+	}
+
+	// A frozen install fails when the configuration disagrees with the lockfile
+	cfg.Rules = append(cfg.Rules, config.Rule{Name: "unlocked", URL: server.URL + "/rule"})
+	err = DownloadAllRules(cfg, Options{Frozen: true})
+	if err == nil || !strings.Contains(err.Error(), "disagree") {
+		t.Errorf("Expected an error about the configuration and lockfile disagreeing, got: %v", err)
+	}
+}
+
+func TestDownloadRuleIntegrity(t *testing.T) {
+	content := "# Pinned rule\n\nPinned content."
+
+	// Create HTTP test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "integrity-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sum := sha256.Sum256([]byte(content))
+	expected := hex.EncodeToString(sum[:])
+
+	// The hash is computed before conversion, so it also applies to .cursorrules files
+	matchingRule := config.Rule{
+		Name:   "pinned",
+		URL:    server.URL + "/pinned.cursorrules",
+		SHA256: strings.ToUpper(expected),
+	}
+	if err := DownloadRule(matchingRule, tempDir); err != nil {
+		t.Errorf("Error occurred for matching sha256: %v", err)
+	}
+
+	mismatchRule := config.Rule{
+		Name:   "tampered",
+		URL:    server.URL + "/tampered.mdc",
+		SHA256: strings.Repeat("0", 64),
+	}
+	err = DownloadRule(mismatchRule, tempDir)
+
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("Expected an IntegrityError, got: %v", err)
+	}
+	if integrityErr.Rule != "tampered" || integrityErr.Expected != mismatchRule.SHA256 || integrityErr.Actual != expected {
+		t.Errorf("IntegrityError has unexpected fields: %+v", integrityErr)
+	}
+	for _, part := range []string{"tampered", mismatchRule.SHA256, expected} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("Error message does not include '%s': %s", part, err.Error())
+		}
+	}
+
+	// Nothing must be written on a mismatch
+	if _, err := os.Stat(filepath.Join(tempDir, "tampered.mdc")); !os.IsNotExist(err) {
+		t.Error("File was written despite an integrity mismatch")
+	}
+}
+
+func TestCheckRuleUpdatesIntegrity(t *testing.T) {
+	// Create HTTP test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Upstream content"))
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "check-integrity-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	sum := sha256.Sum256([]byte("Upstream content"))
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "intact", URL: server.URL + "/intact", SHA256: hex.EncodeToString(sum[:])},
+			{Name: "drifted", URL: server.URL + "/drifted", SHA256: strings.Repeat("0", 64)},
+		},
+	}
+
+	statuses, err := CheckRuleUpdates(cfg, Options{})
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+
+	if statuses[0].IntegrityMismatch {
+		t.Error("Integrity mismatch was reported for matching content")
+	}
+	if !statuses[1].IntegrityMismatch {
+		t.Error("Integrity mismatch was not reported for drifted content")
+	}
+	if statuses[1].RemoteSHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Remote SHA-256 differs from expected. Expected: %s, Actual: %s", hex.EncodeToString(sum[:]), statuses[1].RemoteSHA256)
+	}
+}
+
+func TestDownloadAllRulesWithClient(t *testing.T) {
+	// Serve all requests from a custom transport instead of the network
+	var requested []string
+	var mu sync.Mutex
+	client := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		mu.Lock()
+		requested = append(requested, req.URL.String())
+		mu.Unlock()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("Injected content")),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})}
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "client-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "injected", URL: "https://rules.invalid/injected.mdc"}},
+	}
+	if err := DownloadAllRules(cfg, Options{Client: client}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	if len(requested) != 1 || requested[0] != "https://rules.invalid/injected.mdc" {
+		t.Errorf("Injected client was not used. Requests: %v", requested)
+	}
+	content, err := os.ReadFile(filepath.Join(tempDir, ".cursor", "rules", "injected.mdc"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "Injected content" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "Injected content", string(content))
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestDownloadAllRulesRedactsCredentials(t *testing.T) {
+	// Create HTTP test server that requires basic credentials
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "deploy" || pass != "secret-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Private rule content"))
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "redact-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	privateURL := strings.Replace(server.URL, "http://", "http://deploy:secret-token@", 1) + "/private.mdc"
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "private", URL: privateURL}},
+		Path:  filepath.Join(tempDir, "currm.yaml"),
+	}
+	opts := Options{Auth: auth.NewResolver(nil)}
+
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	lockContent, err := os.ReadFile(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to read lockfile: %v", err)
+	}
+	if strings.Contains(string(lockContent), "secret-token") {
+		t.Errorf("Credentials were written to the lockfile:\n%s", string(lockContent))
+	}
+
+	// A frozen install still authenticates with the credentials from the configuration
+	if err := DownloadAllRules(cfg, Options{Auth: opts.Auth, Frozen: true}); err != nil {
+		t.Errorf("Frozen install returned an error: %v", err)
+	}
+}
+
+func TestDownloadAllRulesOffline(t *testing.T) {
+	// Create HTTP test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("Stored " + r.URL.Path))
+	}))
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "offline-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "stored", URL: server.URL + "/group/project/-/raw/main/stored.cursorrules", Revision: "v1"}},
+		Path:  filepath.Join(tempDir, "currm.yaml"),
+		// The test server stands in for a self-hosted GitLab so that revisions can be applied
+		Providers: map[string][]string{"gitlab": {"127.0.0.1"}},
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+
+	// Fetch once while the network is available
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	server.Close()
+
+	// Install again without the server, after removing the installed file
+	rulePath := filepath.Join(tempDir, ".cursor", "rules", "stored-v1.mdc")
+	if err := os.Remove(rulePath); err != nil {
+		t.Fatalf("Failed to remove rule file: %v", err)
+	}
+	opts.Offline = true
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("Offline install returned an error: %v", err)
+	}
+
+	content, err := os.ReadFile(rulePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "---\ndescription: stored\n") || !strings.HasSuffix(string(content), "Stored /group/project/-/raw/v1/stored.cursorrules") {
+		t.Errorf("Offline install did not convert the stored content:\n%s", string(content))
+	}
+
+	// Rules that were never fetched fail clearly
+	cfg.Rules = append(cfg.Rules, config.Rule{Name: "never-fetched", URL: server.URL + "/never.mdc"})
+	err = DownloadAllRules(cfg, opts)
+	if err == nil {
+		t.Error("No error was returned for a rule that was never fetched")
+	}
+}
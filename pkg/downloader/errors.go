@@ -0,0 +1,103 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+// ErrSkipped is the error of rules that were not installed because an earlier rule failed in fail-fast mode
+var ErrSkipped = errors.New("skipped after an earlier rule failed")
+
+// RuleError is the failure of a single rule
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("rule '%s': %v", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// PullError is returned when some rules could not be installed.
+// It lists every failed rule in configuration order; errors.As finds the errors of the single rules as well.
+type PullError struct {
+	Failures []*RuleError
+	// Skipped lists the rules that were not attempted because an earlier rule failed in fail-fast mode
+	Skipped []string
+	// Total is the number of rules that were to be installed
+	Total int
+}
+
+func (e *PullError) Error() string {
+	names := make([]string, len(e.Failures))
+	for i, failure := range e.Failures {
+		names[i] = failure.Rule
+	}
+	message := fmt.Sprintf("%d of %d rule(s) could not be installed: %s", len(e.Failures), e.Total, strings.Join(names, ", "))
+	if len(e.Skipped) > 0 {
+		message += fmt.Sprintf("; %d skipped", len(e.Skipped))
+	}
+	return message
+}
+
+func (e *PullError) Unwrap() []error {
+	errs := make([]error, len(e.Failures))
+	for i, failure := range e.Failures {
+		errs[i] = failure
+	}
+	return errs
+}
+
+// collectFailures returns the failed rules as a PullError, or nil if all rules succeeded
+func collectFailures(rules []config.Rule, outcomes []installOutcome) *PullError {
+	pullErr := &PullError{Total: len(rules)}
+	for i, rule := range rules {
+		switch err := outcomes[i].err; {
+		case errors.Is(err, ErrSkipped):
+			pullErr.Skipped = append(pullErr.Skipped, rule.Name)
+		case err != nil:
+			pullErr.Failures = append(pullErr.Failures, &RuleError{Rule: rule.Name, Err: err})
+		}
+	}
+	if len(pullErr.Failures) == 0 && len(pullErr.Skipped) == 0 {
+		return nil
+	}
+	return pullErr
+}
+
+// printSummary prints a table with the outcome of every rule.
+// Unless installed is set, the rules that succeeded were not installed because of the others.
+func printSummary(rules []config.Rule, outcomes []installOutcome, installed bool) {
+	fmt.Println("\nSummary:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RULE\tRESULT\tDETAILS")
+	for i, rule := range rules {
+		result, err := outcomes[i].result, outcomes[i].err
+		switch {
+		case errors.Is(err, ErrSkipped):
+			fmt.Fprintf(w, "%s\tskipped\t%v\n", rule.Name, err)
+		case err != nil:
+			fmt.Fprintf(w, "%s\tfailed\t%v\n", rule.Name, err)
+		case !installed:
+			fmt.Fprintf(w, "%s\tnot installed\tother rules failed\n", rule.Name)
+		case result.Unchanged:
+			fmt.Fprintf(w, "%s\tup to date\t%s\n", rule.Name, result.Path)
+		default:
+			fmt.Fprintf(w, "%s\tinstalled\t%s\n", rule.Name, result.Path)
+		}
+	}
+	w.Flush()
+
+	if !installed {
+		fmt.Println("\nNo rules were changed")
+	}
+}
@@ -0,0 +1,113 @@
+package downloader
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestDownloadAllRulesFailures(t *testing.T) {
+	// Create HTTP test server
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "failures-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "ok", URL: server.URL + "/ok"},
+			{Name: "missing", URL: server.URL + "/missing"},
+			{Name: "tampered", URL: server.URL + "/tampered", SHA256: strings.Repeat("0", 64)},
+		},
+		Path: filepath.Join(tempDir, "currm.yaml"),
+	}
+
+	// Every failure is collected, and the errors of single rules can be inspected
+	err = DownloadAllRules(cfg, Options{})
+	var pullErr *PullError
+	if !errors.As(err, &pullErr) {
+		t.Fatalf("DownloadAllRules function did not return a PullError: %v", err)
+	}
+	var names []string
+	for _, failure := range pullErr.Failures {
+		names = append(names, failure.Rule)
+	}
+	if strings.Join(names, ",") != "missing,tampered" {
+		t.Errorf("Failed rules differ from expected. Expected: %s, Actual: %s", "missing,tampered", strings.Join(names, ","))
+	}
+	var integrityErr *IntegrityError
+	if !errors.As(err, &integrityErr) || integrityErr.Rule != "tampered" {
+		t.Errorf("IntegrityError was not found in the PullError: %v", err)
+	}
+
+	// Nothing is installed unless every rule succeeded
+	rulePath := filepath.Join(tempDir, ".cursor", "rules", "ok.mdc")
+	if _, err := os.Stat(rulePath); err == nil {
+		t.Error("Rule was installed although other rules failed")
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, lockfile.FileName)); err == nil {
+		t.Error("Lockfile was written although rules failed")
+	}
+
+	// With keep-going, the rules that succeeded are installed and the failures are still returned
+	err = DownloadAllRules(cfg, Options{KeepGoing: true})
+	if !errors.As(err, &pullErr) || len(pullErr.Failures) != 2 {
+		t.Fatalf("Expected a PullError for the failed rules with keep-going, got: %v", err)
+	}
+	if _, err := os.Stat(rulePath); err != nil {
+		t.Errorf("Rule that could be installed was not installed: %v", err)
+	}
+
+	// In fail-fast mode, the rules after the first failure are skipped
+	cfg.Rules = []config.Rule{
+		{Name: "first", URL: server.URL + "/missing"},
+		{Name: "second", URL: server.URL + "/missing"},
+		{Name: "third", URL: server.URL + "/missing"},
+	}
+	err = DownloadAllRules(cfg, Options{FailFast: true, Jobs: 1})
+	if !errors.As(err, &pullErr) || len(pullErr.Failures) != 1 {
+		t.Fatalf("Expected a PullError for a single failed rule, got: %v", err)
+	}
+	if len(pullErr.Skipped) != 2 {
+		t.Errorf("Number of skipped rules does not match. Expected: %d, Actual: %d", 2, len(pullErr.Skipped))
+	}
+	if !strings.HasSuffix(pullErr.Error(), "; 2 skipped") {
+		t.Errorf("Error message does not mention the skipped rules: %s", pullErr.Error())
+	}
+
+	if err := DownloadAllRules(cfg, Options{FailFast: true, KeepGoing: true}); err == nil {
+		t.Error("No error was returned for combining fail-fast and keep-going")
+	}
+}
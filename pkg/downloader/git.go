@@ -0,0 +1,258 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/guchey/currm/pkg/auth"
+	"github.com/guchey/currm/pkg/config"
+)
+
+// gitRef returns the ref a git rule is fetched at, or an empty string for the default branch
+func gitRef(rule config.Rule) string {
+	if rule.Git.Ref != "" {
+		return rule.Git.Ref
+	}
+	if rule.Revision != "latest" {
+		return rule.Revision
+	}
+	return ""
+}
+
+// gitPath returns the path of the rule file relative to the root of the repository
+func gitPath(source *config.GitSource) string {
+	return strings.TrimPrefix(path.Clean("/"+source.Path), "/")
+}
+
+// redactGitSource returns a copy of the git source without credentials in the repository URL
+func redactGitSource(source *config.GitSource) *config.GitSource {
+	if source == nil {
+		return nil
+	}
+	redacted := *source
+	redacted.Repo = auth.Redact(source.Repo)
+	return &redacted
+}
+
+// gitSource reads rule files from git repositories using the git binary.
+// Each repository is fetched shallowly into its own bare repository in the cache directory.
+type gitSource struct {
+	mu    sync.Mutex
+	repos map[string]*sync.Mutex
+}
+
+// newGitSource creates a git source
+func newGitSource() *gitSource {
+	return &gitSource{repos: make(map[string]*sync.Mutex)}
+}
+
+// Resolve identifies the content of a git rule by its repository, ref and path
+func (g *gitSource) Resolve(rule config.Rule) (string, error) {
+	ref := gitRef(rule)
+	if ref == "" {
+		ref = "HEAD"
+	}
+	return fmt.Sprintf("%s#%s:%s", rule.Git.Repo, ref, gitPath(rule.Git)), nil
+}
+
+// lock serializes fetches from the same repository, which share a bare repository
+func (g *gitSource) lock(repo string) func() {
+	g.mu.Lock()
+	m, ok := g.repos[repo]
+	if !ok {
+		m = &sync.Mutex{}
+		g.repos[repo] = m
+	}
+	g.mu.Unlock()
+
+	m.Lock()
+	return m.Unlock
+}
+
+// Fetch reads the rule file at the configured ref and reports the commit it was read from
+func (g *gitSource) Fetch(req *FetchRequest) (*FetchResult, error) {
+	rule := req.Rule
+	source := rule.Git
+	if rule.URL != "" || rule.Path != "" {
+		return nil, fmt.Errorf("rule '%s' sets git together with url or path; use only one", rule.Name)
+	}
+	if source.Repo == "" || source.Path == "" {
+		return nil, fmt.Errorf("git source of rule '%s' requires repo and path", rule.Name)
+	}
+
+	repo := auth.Redact(source.Repo)
+	defer g.lock(repo)()
+
+	dir, cleanup, err := repoDir(req.CacheDir, repo)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	ref := gitRef(rule)
+	if req.Revision != "" {
+		ref = req.Revision
+	}
+
+	commit, err := resolveGitRef(dir, source.Repo, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch rule '%s' from '%s': %w", rule.Name, repo, err)
+	}
+
+	content, err := gitCommand(dir, "cat-file", "blob", commit+":"+gitPath(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read '%s' of rule '%s' at commit %s: %w", gitPath(source), rule.Name, getShortRevision(commit), err)
+	}
+
+	return &FetchResult{Content: content, Revision: commit}, nil
+}
+
+// Tags lists the tags of the repository with git ls-remote
+func (g *gitSource) Tags(req *FetchRequest) ([]string, error) {
+	rule := req.Rule
+	if rule.Git.Repo == "" {
+		return nil, fmt.Errorf("git source of rule '%s' requires repo and path", rule.Name)
+	}
+
+	repo := auth.Redact(rule.Git.Repo)
+	defer g.lock(repo)()
+
+	dir, cleanup, err := repoDir(req.CacheDir, repo)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	output, err := gitCommand(dir, "ls-remote", "--tags", "--refs", rule.Git.Repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags of '%s': %w", repo, err)
+	}
+
+	var tags []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if _, ref, ok := strings.Cut(strings.TrimSpace(line), "\t"); ok {
+			tags = append(tags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	return tags, nil
+}
+
+// ListDir lists the files under the directory of the rule at the configured ref
+func (g *gitSource) ListDir(req *FetchRequest) ([]config.Rule, error) {
+	rule := req.Rule
+	source := rule.Git
+	if source.Repo == "" {
+		return nil, fmt.Errorf("git source of rule '%s' requires repo", rule.Name)
+	}
+
+	repo := auth.Redact(source.Repo)
+	defer g.lock(repo)()
+
+	dir, cleanup, err := repoDir(req.CacheDir, repo)
+	if err != nil {
+		return nil, err
+	}
+	defer cleanup()
+
+	commit, err := resolveGitRef(dir, source.Repo, gitRef(rule))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the directory of rule '%s' from '%s': %w", rule.Name, repo, err)
+	}
+
+	args := []string{"ls-tree", "-r", "-z", "--name-only", commit}
+	prefix := gitPath(source)
+	if prefix != "" {
+		prefix += "/"
+		args = append(args, "--", prefix)
+	}
+	output, err := gitCommand(dir, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the directory of rule '%s': %w", rule.Name, err)
+	}
+
+	var files []config.Rule
+	for _, name := range strings.Split(string(output), "\x00") {
+		if name == "" {
+			continue
+		}
+		file := *source
+		file.Path = name
+		files = append(files, config.Rule{Name: strings.TrimPrefix(name, prefix), Git: &file})
+	}
+	return files, nil
+}
+
+// repoDir returns the bare repository used for repo, creating it if needed.
+// Without a cache directory, a temporary repository is used that is removed by the returned function.
+func repoDir(cacheDir string, repo string) (string, func(), error) {
+	dir := ""
+	cleanup := func() {}
+	if cacheDir != "" {
+		dir = filepath.Join(cacheDir, "git", sha256Hex([]byte(repo)))
+	} else {
+		tempDir, err := os.MkdirTemp("", "currm-git-*")
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to create git directory: %w", err)
+		}
+		dir = tempDir
+		cleanup = func() { os.RemoveAll(tempDir) }
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "HEAD")); err == nil {
+		return dir, cleanup, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to create git directory: %w", err)
+	}
+	if _, err := gitCommand(dir, "init", "--bare", "--quiet"); err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return dir, cleanup, nil
+}
+
+// resolveGitRef fetches ref from repo and returns the commit it points to.
+// Commits that were fetched before are not fetched again since they cannot change.
+func resolveGitRef(dir string, repo string, ref string) (string, error) {
+	if len(ref) == 40 && isHexString(ref) {
+		if _, err := gitCommand(dir, "cat-file", "-e", ref+"^{commit}"); err == nil {
+			return strings.ToLower(ref), nil
+		}
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := gitCommand(dir, "fetch", "--quiet", "--depth", "1", "--no-tags", repo, ref); err != nil {
+		return "", err
+	}
+
+	commit, err := gitCommand(dir, "rev-parse", "--verify", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(commit)), nil
+}
+
+// gitCommand executes a git command against the bare repository in dir
+func gitCommand(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir", dir}, args...)...)
+	// Never fall back to an interactive prompt
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -0,0 +1,302 @@
+package downloader
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+// runGit runs git in dir and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=currm", "GIT_AUTHOR_EMAIL=currm@example.com",
+		"GIT_COMMITTER_NAME=currm", "GIT_COMMITTER_EMAIL=currm@example.com",
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v: %s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// commitRule writes the rule file in the work tree, commits it and pushes it to the bare repository
+func commitRule(t *testing.T, workDir string, content string) string {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(workDir, "rules", "style.mdc"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "--quiet", "-m", content)
+	runGit(t, workDir, "push", "--quiet", "origin", "main")
+	return runGit(t, workDir, "rev-parse", "HEAD")
+}
+
+func TestDownloadAllRulesGit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "git-rules-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a bare repository and a work tree that pushes to it
+	bareDir := filepath.Join(tempDir, "repo.git")
+	workDir := filepath.Join(tempDir, "work")
+	runGit(t, tempDir, "init", "--quiet", "--bare", "--initial-branch", "main", bareDir)
+	runGit(t, tempDir, "init", "--quiet", "--initial-branch", "main", workDir)
+	runGit(t, workDir, "remote", "add", "origin", bareDir)
+	if err := os.MkdirAll(filepath.Join(workDir, "rules"), 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+	first := commitRule(t, workDir, "first version")
+
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project directory: %v", err)
+	}
+
+	// Change to temporary directory
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	repo := "file://" + filepath.ToSlash(bareDir)
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "style", Git: &config.GitSource{Repo: repo, Ref: "main", Path: "rules/style.mdc"}},
+		},
+		Path: filepath.Join(projectDir, "currm.yaml"),
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	filePath := filepath.Join(projectDir, ".cursor", "rules", "style.mdc")
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "first version" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "first version", string(content))
+	}
+
+	// The lockfile records the exact commit the ref resolved to
+	lock, err := lockfile.Load(filepath.Join(projectDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	locked := lock.Find("style")
+	if locked == nil || locked.ResolvedCommit != first {
+		t.Fatalf("Resolved commit was not locked. Expected: %s, Actual: %+v", first, locked)
+	}
+	if locked.Git == nil || locked.Git.Ref != "main" {
+		t.Errorf("Git source was not locked as configured. Actual: %+v", locked.Git)
+	}
+
+	// An offline install keeps the commit the branch resolved to
+	if err := DownloadAllRules(cfg, Options{CacheDir: opts.CacheDir, Offline: true}); err != nil {
+		t.Fatalf("Offline install returned an error: %v", err)
+	}
+	lock, err = lockfile.Load(filepath.Join(projectDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if locked := lock.Find("style"); locked == nil || locked.ResolvedCommit != first {
+		t.Fatalf("Offline install dropped the resolved commit. Expected: %s, Actual: %+v", first, locked)
+	}
+
+	// check notices when the branch moves
+	commitRule(t, workDir, "second version")
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	if statuses[0].State != StateUpstreamChanged {
+		t.Errorf("State of rule does not match. Expected: %s, Actual: %s", StateUpstreamChanged, statuses[0].State)
+	}
+
+	// A frozen install uses the locked commit instead of the moved branch
+	if err := DownloadAllRules(cfg, Options{CacheDir: opts.CacheDir, Frozen: true}); err != nil {
+		t.Fatalf("Frozen install returned an error: %v", err)
+	}
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "first version" {
+		t.Errorf("Frozen install did not use the locked commit. Expected: %s, Actual: %s", "first version", string(content))
+	}
+
+	// Pulling again follows the branch
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "second version" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "second version", string(content))
+	}
+
+	// A missing file in the repository is an error
+	cfg.Rules[0].Git.Path = "rules/missing.mdc"
+	if err := DownloadRule(cfg.Rules[0], filepath.Join(tempDir, "missing")); err == nil {
+		t.Error("No error was returned for a file that is not in the repository")
+	}
+}
+
+func TestDownloadAllRulesVersionRange(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "git-range-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Create a bare repository and a work tree that pushes to it
+	bareDir := filepath.Join(tempDir, "repo.git")
+	workDir := filepath.Join(tempDir, "work")
+	runGit(t, tempDir, "init", "--quiet", "--bare", "--initial-branch", "main", bareDir)
+	runGit(t, tempDir, "init", "--quiet", "--initial-branch", "main", workDir)
+	runGit(t, workDir, "remote", "add", "origin", bareDir)
+	if err := os.MkdirAll(filepath.Join(workDir, "rules"), 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+	release := func(tag string) {
+		commitRule(t, workDir, "version "+tag)
+		runGit(t, workDir, "tag", tag)
+		runGit(t, workDir, "push", "--quiet", "origin", tag)
+	}
+	release("v1.2.0")
+	release("v1.3.0-rc.1")
+
+	projectDir := filepath.Join(tempDir, "project")
+	if err := os.MkdirAll(projectDir, 0755); err != nil {
+		t.Fatalf("Failed to create project directory: %v", err)
+	}
+
+	// Change to temporary directory
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	repo := "file://" + filepath.ToSlash(bareDir)
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "style", Revision: "^1.2", Git: &config.GitSource{Repo: repo, Path: "rules/style.mdc"}},
+		},
+		Path: filepath.Join(projectDir, "currm.yaml"),
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+
+	// The highest release in range is installed; pre-releases are skipped
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	// The file name does not carry the range, so it stays the same when the tag moves
+	filePath := filepath.Join(projectDir, ".cursor", "rules", "style.mdc")
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "version v1.2.0" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "version v1.2.0", string(content))
+	}
+
+	lock, err := lockfile.Load(filepath.Join(projectDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if locked := lock.Find("style"); locked == nil || locked.ResolvedRevision != "v1.2.0" {
+		t.Fatalf("Resolved tag was not locked. Expected: %s, Actual: %+v", "v1.2.0", locked)
+	}
+
+	// A compatible release and a new major version are told apart
+	release("v1.3.0")
+	release("v2.0.0")
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	status := statuses[0]
+	if status.State != StateNewerCompatible || !status.NeedsUpdate {
+		t.Errorf("State of rule does not match. Expected: %s, Actual: %s", StateNewerCompatible, status.State)
+	}
+	if status.InstalledTag != "v1.2.0" || status.UpstreamTag != "v1.3.0" || status.NewerMajor != "v2.0.0" {
+		t.Errorf("Tags do not match. Actual: installed %s, upstream %s, newer major %s", status.InstalledTag, status.UpstreamTag, status.NewerMajor)
+	}
+
+	// A frozen install stays at the locked tag
+	if err := DownloadAllRules(cfg, Options{CacheDir: opts.CacheDir, Frozen: true}); err != nil {
+		t.Fatalf("Frozen install returned an error: %v", err)
+	}
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "version v1.2.0" {
+		t.Errorf("Frozen install did not use the locked tag. Expected: %s, Actual: %s", "version v1.2.0", string(content))
+	}
+
+	// Pulling moves to the new compatible release but not to the new major version
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "version v1.3.0" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "version v1.3.0", string(content))
+	}
+
+	statuses, err = CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	if statuses[0].State != StateNewerMajor || statuses[0].NeedsUpdate {
+		t.Errorf("State of rule does not match. Expected: %s, Actual: %s", StateNewerMajor, statuses[0].State)
+	}
+
+	// A range no tag satisfies is an error
+	cfg.Rules[0].Revision = "^3"
+	if err := DownloadRule(cfg.Rules[0], filepath.Join(tempDir, "none")); err == nil {
+		t.Error("No error was returned for a version range without matching tags")
+	}
+}
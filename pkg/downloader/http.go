@@ -0,0 +1,120 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/guchey/currm/pkg/auth"
+	"github.com/guchey/currm/pkg/cache"
+	"github.com/guchey/currm/pkg/config"
+)
+
+// httpSource fetches rules from plain HTTP and HTTPS URLs
+type httpSource struct{}
+
+// Resolve returns the URL of the rule as configured.
+// A revision cannot be applied to a URL of an unknown host, so it is an error rather than silently ignored.
+func (httpSource) Resolve(rule config.Rule) (string, error) {
+	if hasRevision(rule) {
+		return "", revisionError(rule, "the host is not a known git provider; add it under 'providers' in the configuration or put the revision in the URL")
+	}
+	return rule.URL, nil
+}
+
+// Fetch downloads the rule, sending a conditional request when validators are given
+func (httpSource) Fetch(req *FetchRequest) (*FetchResult, error) {
+	return fetchContent(req.Client, req.Rule, req.Location, req.Validators)
+}
+
+// newRuleRequest creates a request for the rule, made conditional when validators are given
+func newRuleRequest(method string, rule config.Rule, url string, validators *cache.Validators) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for rule '%s': %w", rule.Name, err)
+	}
+
+	if validators != nil {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+	return req, nil
+}
+
+// fetchContent downloads the content of the rule from the given URL.
+// When validators are given, the request is conditional and may report that the content is unchanged.
+func fetchContent(client *http.Client, rule config.Rule, url string, validators *cache.Validators) (*FetchResult, error) {
+	req, err := newRuleRequest(http.MethodGet, rule, url, validators)
+	if err != nil {
+		return nil, err
+	}
+
+	// Execute HTTP request to download the rule
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download rule '%s': %w", rule.Name, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && validators != nil {
+		return &FetchResult{NotModified: true}, nil
+	}
+
+	// Verify the HTTP response status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download rule '%s': HTTP status code %d", rule.Name, resp.StatusCode)
+	}
+
+	// Read the content from the response
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content for rule '%s': %w", rule.Name, err)
+	}
+
+	if isHTML(resp.Header.Get("Content-Type"), content) {
+		return nil, fmt.Errorf("refusing to install rule '%s': '%s' returned an HTML page instead of the rule file; %s", rule.Name, auth.Redact(url), rawURLHint(url))
+	}
+
+	return &FetchResult{
+		Content:      content,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
+}
+
+// isHTML reports whether a response is a web page rather than a rule file
+func isHTML(contentType string, content []byte) bool {
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil && mediaType == "text/html" {
+		return true
+	}
+
+	// Some servers send web pages as text/plain, so look at the document itself
+	start := bytes.TrimLeft(bytes.TrimPrefix(content, []byte("\xef\xbb\xbf")), " \t\r\n")
+	if len(start) > 15 {
+		start = start[:15]
+	}
+	lower := strings.ToLower(string(start))
+	return strings.HasPrefix(lower, "<!doctype html") || strings.HasPrefix(lower, "<html")
+}
+
+// rawURLHint suggests where to find the raw content of a URL that returned a web page
+func rawURLHint(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err == nil {
+		switch u.Hostname() {
+		case "github.com":
+			return "use a link to the file such as https://github.com/owner/repo/blob/ref/path or its raw URL https://raw.githubusercontent.com/owner/repo/ref/path"
+		case "gist.github.com":
+			return "use the raw URL of the gist such as https://gist.githubusercontent.com/user/id/raw/file"
+		}
+	}
+	return "use the URL of the raw file, usually reached through the 'Raw' button on the file page"
+}
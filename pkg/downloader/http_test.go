@@ -0,0 +1,63 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+func TestIsHTML(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		content     string
+		expected    bool
+	}{
+		{name: "html content type", contentType: "text/html; charset=utf-8", content: "anything", expected: true},
+		{name: "doctype", contentType: "text/plain", content: "\n  <!DOCTYPE html>\n<html>", expected: true},
+		{name: "html tag", contentType: "", content: "<HTML lang=\"en\">", expected: true},
+		{name: "byte order mark", contentType: "", content: "\xef\xbb\xbf<!doctype html>", expected: true},
+		{name: "markdown", contentType: "text/plain; charset=utf-8", content: "# Rules\n\n<html> is mentioned later", expected: false},
+		{name: "front matter", contentType: "application/octet-stream", content: "---\ndescription: x\n---\n", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := isHTML(tt.contentType, []byte(tt.content)); actual != tt.expected {
+				t.Errorf("isHTML does not match. Expected: %t, Actual: %t", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDownloadRuleRejectsHTML(t *testing.T) {
+	// Create HTTP test server that serves a web page like a repository browser does
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("<!DOCTYPE html><html><body>rule</body></html>"))
+	}))
+	defer server.Close()
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "html-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	rule := config.Rule{Name: "page", URL: server.URL + "/owner/repo/blob/main/rule.mdc"}
+	err = DownloadRule(rule, tempDir)
+	if err == nil || !strings.Contains(err.Error(), "HTML page") || !strings.Contains(err.Error(), "raw") {
+		t.Errorf("Expected an error about an HTML page with a hint, got: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(tempDir, "page.mdc")); !os.IsNotExist(err) {
+		t.Error("File was written for an HTML page")
+	}
+}
@@ -0,0 +1,283 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/guchey/currm/pkg/auth"
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+// RuleType is how Cursor applies a rule, derived from the front matter of its file
+type RuleType string
+
+const (
+	// RuleTypeAlways means the rule is always included (alwaysApply: true)
+	RuleTypeAlways RuleType = "always"
+	// RuleTypeAutoAttached means the rule is included when files matching its globs are referenced
+	RuleTypeAutoAttached RuleType = "auto-attached"
+	// RuleTypeAgentRequested means the agent decides from the description whether to include the rule
+	RuleTypeAgentRequested RuleType = "agent-requested"
+	// RuleTypeManual means the rule is only included when it is mentioned explicitly
+	RuleTypeManual RuleType = "manual"
+)
+
+// RuleInfo describes a configured rule or a file in the rules directory
+type RuleInfo struct {
+	Name string `json:"name" yaml:"name"`
+	// Source is the URL, local path or git repository and path the rule is fetched from; it is empty for unmanaged files
+	Source           string `json:"source,omitempty" yaml:"source,omitempty"`
+	Revision         string `json:"revision,omitempty" yaml:"revision,omitempty"`
+	ResolvedRevision string `json:"resolvedRevision,omitempty" yaml:"resolvedRevision,omitempty"`
+	ResolvedCommit   string `json:"resolvedCommit,omitempty" yaml:"resolvedCommit,omitempty"`
+	// File is the path of the installed file relative to the rules directory; it is empty if the rule is not installed
+	File        string   `json:"file,omitempty" yaml:"file,omitempty"`
+	Size        int64    `json:"size" yaml:"size"`
+	Type        RuleType `json:"type,omitempty" yaml:"type,omitempty"`
+	Globs       string   `json:"globs,omitempty" yaml:"globs,omitempty"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	// Managed is set for files installed by currm, as opposed to rules written by hand
+	Managed bool `json:"managed" yaml:"managed"`
+	// Orphaned is set for files currm installed for a rule that is no longer configured
+	Orphaned bool `json:"orphaned,omitempty" yaml:"orphaned,omitempty"`
+}
+
+// frontMatter holds the fields of the front matter of a rule file that decide how Cursor applies it
+type frontMatter struct {
+	Description string
+	Globs       string
+	AlwaysApply bool
+}
+
+// ListRules returns the rules of the configuration followed by the other rule files in the rules directory.
+// Installed files are read to tell their size and type; nothing is fetched.
+func ListRules(cfg *config.Config) ([]RuleInfo, error) {
+	rulesDir, err := projectRulesDir()
+	if err != nil {
+		return nil, err
+	}
+
+	lock, err := lockfile.Load(lockfile.PathFor(cfg.Path))
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+		lock = lockfile.New()
+	}
+
+	// Dir rules are listed file by file as far as the lockfile knows them
+	var rules []config.Rule
+	for _, rule := range cfg.Rules {
+		if rule.Dir != nil && validateDirRule(rule) == nil {
+			if imported, err := importedFromLock(rule, lock); err == nil {
+				rules = append(rules, imported...)
+				continue
+			}
+		}
+		rules = append(rules, rule)
+	}
+
+	infos := make([]RuleInfo, 0, len(rules))
+	listed := make(map[string]bool)
+	for _, rule := range rules {
+		info := RuleInfo{
+			Name:     rule.Name,
+			Source:   ruleSource(rule),
+			Revision: rule.Revision,
+		}
+		if rule.Git != nil && rule.Git.Ref != "" && info.Revision == "" {
+			info.Revision = rule.Git.Ref
+		}
+
+		file := ruleFileName(rule)
+		if locked := lock.Find(rule.Name); locked != nil {
+			file = lockedFileName(*locked)
+			info.ResolvedRevision = locked.ResolvedRevision
+			info.ResolvedCommit = locked.ResolvedCommit
+		}
+		if rule.Dir == nil {
+			listed[file] = true
+			// A name that leaves the rules directory is never installed, so there is nothing to read
+			if _, err := confinePath(rulesDir, file); err == nil {
+				if err := readRuleFile(rulesDir, file, &info); err != nil {
+					return nil, err
+				}
+			}
+			info.Managed = info.File != ""
+		}
+		infos = append(infos, info)
+	}
+
+	orphaned := make(map[string]bool)
+	for _, file := range lock.Orphaned {
+		orphaned[file.File] = true
+	}
+
+	// Every other rule file was either left behind by a removed rule or written by hand
+	files, err := ruleFiles(rulesDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if listed[file] {
+			continue
+		}
+		info := RuleInfo{
+			Name:     strings.TrimSuffix(file, path.Ext(file)),
+			Managed:  orphaned[file],
+			Orphaned: orphaned[file],
+		}
+		if err := readRuleFile(rulesDir, file, &info); err != nil {
+			return nil, err
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// ruleSource describes where a rule is fetched from
+func ruleSource(rule config.Rule) string {
+	switch {
+	case rule.Dir != nil && rule.Dir.Git != nil:
+		return auth.Redact(rule.Dir.Git.Repo) + "#" + rule.Dir.Git.Path
+	case rule.Dir != nil:
+		return auth.Redact(rule.Dir.URL)
+	case rule.Git != nil:
+		return auth.Redact(rule.Git.Repo) + "#" + rule.Git.Path
+	case rule.Path != "":
+		return filepath.ToSlash(rule.Path)
+	}
+	return auth.Redact(rule.URL)
+}
+
+// ruleFiles returns the slash separated paths of the .mdc files in the rules directory, skipping hidden directories
+func ruleFiles(rulesDir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(rulesDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if filePath != rulesDir && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || filepath.Ext(filePath) != ".mdc" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(rulesDir, filePath)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rules directory: %w", err)
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// readRuleFile fills in the file, size and front matter of the info from an installed file, if it exists
+func readRuleFile(rulesDir string, file string, info *RuleInfo) error {
+	filePath := filepath.Join(rulesDir, filepath.FromSlash(file))
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read file '%s': %w", filePath, err)
+	}
+
+	matter := parseFrontMatter(content)
+	info.File = file
+	info.Size = int64(len(content))
+	info.Globs = matter.Globs
+	info.Description = matter.Description
+	info.Type = matter.ruleType()
+	return nil
+}
+
+// ruleType returns how Cursor applies a rule with this front matter
+func (m frontMatter) ruleType() RuleType {
+	switch {
+	case m.AlwaysApply:
+		return RuleTypeAlways
+	case m.Globs != "":
+		return RuleTypeAutoAttached
+	case m.Description != "":
+		return RuleTypeAgentRequested
+	}
+	return RuleTypeManual
+}
+
+// parseFrontMatter reads the front matter of a rule file.
+// Cursor writes values such as "globs: *.go" that are not valid YAML, so the keys are read line by line.
+func parseFrontMatter(content []byte) frontMatter {
+	var matter frontMatter
+	if !hasFrontMatter(content) {
+		return matter
+	}
+
+	text := strings.TrimLeft(strings.TrimPrefix(string(content), "\xef\xbb\xbf"), " \t\r\n")
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")[1:]
+	key := ""
+	var list []string
+	for _, line := range lines {
+		if strings.TrimSpace(line) == "---" {
+			break
+		}
+
+		// Items of a YAML list, such as globs written one per line
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "- ") && key == "globs" {
+			list = append(list, unquote(strings.TrimPrefix(trimmed, "- ")))
+			matter.Globs = strings.Join(list, ",")
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.HasPrefix(line, " ") {
+			continue
+		}
+		key = strings.TrimSpace(name)
+		value = unquote(strings.TrimSpace(value))
+		switch key {
+		case "description":
+			matter.Description = value
+		case "globs":
+			matter.Globs = value
+			if strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]") {
+				// A flow list such as ["*.go", "*.mod"]
+				list = nil
+				for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+					list = append(list, unquote(strings.TrimSpace(item)))
+				}
+				matter.Globs = strings.Join(list, ",")
+			}
+		case "alwaysApply":
+			matter.AlwaysApply, _ = strconv.ParseBool(value)
+		}
+	}
+	return matter
+}
+
+// unquote removes the quotes around a front matter value
+func unquote(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+func TestParseFrontMatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected frontMatter
+		ruleType RuleType
+	}{
+		{
+			name:     "always",
+			content:  "---\ndescription: Go style\nglobs: *.go\nalwaysApply: true\n---\n\nUse gofmt",
+			expected: frontMatter{Description: "Go style", Globs: "*.go", AlwaysApply: true},
+			ruleType: RuleTypeAlways,
+		},
+		{
+			name:     "auto-attached with a flow list",
+			content:  "---\nglobs: [\"*.go\", '*.mod']\n---\nUse gofmt",
+			expected: frontMatter{Globs: "*.go,*.mod"},
+			ruleType: RuleTypeAutoAttached,
+		},
+		{
+			name:     "auto-attached with a block list",
+			content:  "---\nglobs:\n  - \"*.ts\"\n  - \"*.tsx\"\nalwaysApply: false\n---\n",
+			expected: frontMatter{Globs: "*.ts,*.tsx"},
+			ruleType: RuleTypeAutoAttached,
+		},
+		{
+			name:     "agent-requested",
+			content:  "\r\n---\r\ndescription: \"Review checklist\"\r\nglobs:\r\n---\r\nCheck tests",
+			expected: frontMatter{Description: "Review checklist"},
+			ruleType: RuleTypeAgentRequested,
+		},
+		{
+			name:     "manual without front matter",
+			content:  "Use gofmt\n---\ndescription: not front matter\n---\n",
+			ruleType: RuleTypeManual,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual := parseFrontMatter([]byte(tt.content))
+			if actual != tt.expected {
+				t.Errorf("Front matter does not match. Expected: %+v, Actual: %+v", tt.expected, actual)
+			}
+			if actual.ruleType() != tt.ruleType {
+				t.Errorf("Rule type does not match. Expected: %s, Actual: %s", tt.ruleType, actual.ruleType())
+			}
+		})
+	}
+}
+
+func TestListRules(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "list-rules-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	goRule := "---\ndescription: Go style\nglobs: *.go\nalwaysApply: false\n---\n\nUse gofmt"
+	if err := os.WriteFile("go.mdc", []byte(goRule), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	if err := os.WriteFile("old.mdc", []byte("Old rule"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "go", Path: "go.mdc"},
+			{Name: "old", Path: "old.mdc"},
+		},
+		Path: filepath.Join(tempDir, "currm.yaml"),
+	}
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	// old is removed from the configuration, python is never installed, and mine is written by hand
+	cfg.Rules = []config.Rule{
+		{Name: "go", Path: "go.mdc"},
+		{Name: "python", Path: "python.mdc"},
+	}
+	var pullErr *PullError
+	if err := DownloadAllRules(cfg, Options{KeepGoing: true}); !errors.As(err, &pullErr) {
+		t.Fatalf("DownloadAllRules function did not return a PullError: %v", err)
+	}
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	if err := os.MkdirAll(filepath.Join(rulesDir, "team"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(rulesDir, "team", "mine.mdc"), []byte("---\nalwaysApply: true\n---\nMine"), 0644); err != nil {
+		t.Fatalf("Failed to write hand-written rule: %v", err)
+	}
+
+	infos, err := ListRules(cfg)
+	if err != nil {
+		t.Fatalf("ListRules function returned an error: %v", err)
+	}
+
+	expected := []RuleInfo{
+		{Name: "go", Source: "go.mdc", File: "go.mdc", Size: int64(len(goRule)), Type: RuleTypeAutoAttached, Globs: "*.go", Description: "Go style", Managed: true},
+		{Name: "python", Source: "python.mdc"},
+		{Name: "old", File: "old.mdc", Size: int64(len("Old rule")), Type: RuleTypeManual, Managed: true, Orphaned: true},
+		{Name: "team/mine", File: "team/mine.mdc", Size: int64(len("---\nalwaysApply: true\n---\nMine")), Type: RuleTypeAlways},
+	}
+	if len(infos) != len(expected) {
+		t.Fatalf("Number of rules does not match. Expected: %d, Actual: %d (%+v)", len(expected), len(infos), infos)
+	}
+	for i := range expected {
+		if infos[i] != expected[i] {
+			t.Errorf("Rule %d does not match. Expected: %+v, Actual: %+v", i, expected[i], infos[i])
+		}
+	}
+}
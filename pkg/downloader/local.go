@@ -0,0 +1,72 @@
+package downloader
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+// localSource reads rules from the local filesystem, given by a path field or a file URL
+type localSource struct{}
+
+// Resolve returns how the source of the rule is recorded in the lockfile.
+// The configured value is kept so that the lockfile stays valid on other machines.
+// A local file has no revisions, so a revision is an error rather than a name the file does not live up to.
+func (localSource) Resolve(rule config.Rule) (string, error) {
+	if hasRevision(rule) {
+		return "", fmt.Errorf("revision '%s' of rule '%s' cannot be applied to a local file; remove it", rule.Revision, rule.Name)
+	}
+	if rule.Path != "" {
+		return filepath.ToSlash(rule.Path), nil
+	}
+	return rule.URL, nil
+}
+
+// Fetch reads the content of the rule from disk
+func (localSource) Fetch(req *FetchRequest) (*FetchResult, error) {
+	path, err := localPath(req.Rule, req.ConfigDir)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rule '%s': %w", req.Rule.Name, err)
+	}
+
+	return &FetchResult{Content: content, Path: path}, nil
+}
+
+// localPath returns the file a local rule is read from.
+// Relative paths are resolved against the directory of the configuration file.
+func localPath(rule config.Rule, configDir string) (string, error) {
+	if rule.Path != "" && rule.URL != "" {
+		return "", fmt.Errorf("rule '%s' sets both url and path; use only one", rule.Name)
+	}
+
+	path := rule.Path
+	if path == "" {
+		u, err := url.Parse(rule.URL)
+		if err != nil {
+			return "", fmt.Errorf("invalid file URL for rule '%s': %w", rule.Name, err)
+		}
+		if u.Host != "" && u.Host != "localhost" {
+			return "", fmt.Errorf("invalid file URL for rule '%s': remote host '%s' is not supported", rule.Name, u.Host)
+		}
+
+		// file:relative/path has no leading slash and is relative like a path field
+		path = u.Path
+		if u.Opaque != "" {
+			path = u.Opaque
+		}
+		path = filepath.FromSlash(path)
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(configDir, path)
+	}
+	return path, nil
+}
@@ -0,0 +1,158 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestLocalPath(t *testing.T) {
+	configDir := filepath.FromSlash("/project")
+
+	tests := []struct {
+		name     string
+		rule     config.Rule
+		expected string
+		wantErr  bool
+	}{
+		{name: "relative path", rule: config.Rule{Name: "r", Path: "rules/style.mdc"}, expected: filepath.FromSlash("/project/rules/style.mdc")},
+		{name: "absolute path", rule: config.Rule{Name: "r", Path: filepath.FromSlash("/shared/style.mdc")}, expected: filepath.FromSlash("/shared/style.mdc")},
+		{name: "absolute file URL", rule: config.Rule{Name: "r", URL: "file:///shared/style.mdc"}, expected: filepath.FromSlash("/shared/style.mdc")},
+		{name: "localhost file URL", rule: config.Rule{Name: "r", URL: "file://localhost/shared/style.mdc"}, expected: filepath.FromSlash("/shared/style.mdc")},
+		{name: "relative file URL", rule: config.Rule{Name: "r", URL: "file:rules/style.mdc"}, expected: filepath.FromSlash("/project/rules/style.mdc")},
+		{name: "remote file URL", rule: config.Rule{Name: "r", URL: "file://server/style.mdc"}, wantErr: true},
+		{name: "both url and path", rule: config.Rule{Name: "r", URL: "file:///a.mdc", Path: "a.mdc"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := localPath(tt.rule, configDir)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("No error was returned. Actual: %s", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("localPath returned an error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Path does not match. Expected: %s, Actual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestDownloadAllRulesLocal(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directories for the project and the rule sources
+	tempDir, err := os.MkdirTemp("", "local-rules-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+	sourceDir := filepath.Join(tempDir, "config", "rules")
+	if err := os.MkdirAll(sourceDir, 0755); err != nil {
+		t.Fatalf("Failed to create source directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "style.mdc"), []byte("local style"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(sourceDir, "legacy.cursorrules"), []byte("legacy rules"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	// Relative paths are resolved against the configuration file, not the working directory
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "style", Path: "rules/style.mdc"},
+			{Name: "legacy", URL: "file://" + filepath.ToSlash(filepath.Join(sourceDir, "legacy.cursorrules")), Description: "Legacy"},
+		},
+		Path: filepath.Join(tempDir, "config", "currm.yaml"),
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache"), Offline: true}
+
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	content, err := os.ReadFile(filepath.Join(rulesDir, "style.mdc"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "local style" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "local style", string(content))
+	}
+
+	// Local .cursorrules files are converted like remote ones
+	content, err = os.ReadFile(filepath.Join(rulesDir, "legacy.mdc"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if !strings.HasPrefix(string(content), "---\ndescription: Legacy\n") || !strings.HasSuffix(string(content), "legacy rules") {
+		t.Errorf("Local .cursorrules file was not converted. Actual: %s", string(content))
+	}
+
+	// The lockfile records the path as configured so that it stays portable
+	lock, err := lockfile.Load(filepath.Join(tempDir, "config", lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	locked := lock.Find("style")
+	if locked == nil || locked.Path != "rules/style.mdc" || locked.ResolvedURL != "rules/style.mdc" {
+		t.Errorf("Local rule was not locked by its configured path. Actual: %+v", locked)
+	}
+
+	// check compares the content of local files
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	for _, status := range statuses {
+		if status.State != StateUpToDate {
+			t.Errorf("State of rule '%s' does not match. Expected: %s, Actual: %s", status.Name, StateUpToDate, status.State)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(sourceDir, "style.mdc"), []byte("changed style"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	statuses, err = CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	if statuses[0].State != StateUpstreamChanged {
+		t.Errorf("State of rule '%s' does not match. Expected: %s, Actual: %s", statuses[0].Name, StateUpstreamChanged, statuses[0].State)
+	}
+
+	// A frozen install fails once the local file drifts from the lockfile
+	if err := DownloadAllRules(cfg, Options{Frozen: true}); err == nil {
+		t.Error("No error was returned for content that does not match the lockfile")
+	}
+
+	// A local file has no revisions, so none is applied or put in the file name
+	rule := config.Rule{Name: "pinned", Path: "rules/style.mdc", Revision: "v1"}
+	if err := DownloadRule(rule, rulesDir); err == nil || !strings.Contains(err.Error(), "cannot be applied to a local file") {
+		t.Errorf("No error was returned for a revision of a local rule: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rulesDir, "pinned-v1.mdc")); err == nil {
+		t.Error("Local rule was installed under a revision it was not fetched at")
+	}
+}
@@ -0,0 +1,27 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	// Keep the tests away from the user's cache directory
+	cacheDir, err := os.MkdirTemp("", "downloader-cache-*")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("CURRM_CACHE_DIR", cacheDir)
+
+	// Keep the tests away from the user's credentials; tests that need them set Options.Auth
+	os.Setenv("CURRM_GIT_CREDENTIALS", "0")
+	os.Setenv("CURRM_AUTH_FILE", filepath.Join(cacheDir, "auth.yaml"))
+	os.Setenv("NETRC", filepath.Join(cacheDir, "netrc"))
+	os.Unsetenv("GITHUB_TOKEN")
+	os.Unsetenv("GH_TOKEN")
+
+	code := m.Run()
+	os.RemoveAll(cacheDir)
+	os.Exit(code)
+}
@@ -0,0 +1,128 @@
+package downloader
+
+import (
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+// defaultJobs is the number of rules processed at once when neither a flag nor the configuration sets it
+const defaultJobs = 4
+
+// workerPool limits how many tasks run at once, overall and per host
+type workerPool struct {
+	global  chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]chan struct{}
+}
+
+// newWorkerPool creates a pool running at most jobs tasks at once and at most perHost tasks per host.
+// A perHost value of zero or less disables the per-host limit.
+func newWorkerPool(jobs, perHost int) *workerPool {
+	if jobs < 1 {
+		jobs = 1
+	}
+	return &workerPool{
+		global:  make(chan struct{}, jobs),
+		perHost: perHost,
+		hosts:   make(map[string]chan struct{}),
+	}
+}
+
+// acquire blocks until a slot for the host is available and returns a function releasing it.
+// An empty host is only limited by the overall number of slots.
+func (p *workerPool) acquire(host string) func() {
+	var hostSlots chan struct{}
+	if p.perHost > 0 && host != "" {
+		p.mu.Lock()
+		hostSlots = p.hosts[host]
+		if hostSlots == nil {
+			hostSlots = make(chan struct{}, p.perHost)
+			p.hosts[host] = hostSlots
+		}
+		p.mu.Unlock()
+
+		// Wait for the host slot first so that a busy host does not hold global slots
+		hostSlots <- struct{}{}
+	}
+	p.global <- struct{}{}
+
+	return func() {
+		<-p.global
+		if hostSlots != nil {
+			<-hostSlots
+		}
+	}
+}
+
+// fetchHost returns the host the rule is actually fetched from, such as raw.githubusercontent.com for a
+// github.com file page. It is empty for local rules, which are read from disk.
+func (r *runner) fetchHost(rule config.Rule) string {
+	location := rule.URL
+	if rule.Git != nil {
+		location = rule.Git.Repo
+	}
+	if source, err := r.lookup(rule); err == nil {
+		if _, local := source.(localSource); local {
+			return ""
+		}
+		// The git source appends the ref and path to the repository, which keeps its host
+		if resolved, err := source.Resolve(rule); err == nil && rule.Git == nil {
+			location = resolved
+		}
+	}
+	return locationHost(location)
+}
+
+// locationHost returns the host of a URL or of an scp-like git address such as git@host:owner/repo.git
+func locationHost(location string) string {
+	if u, err := url.Parse(location); err == nil && u.Host != "" {
+		return strings.ToLower(u.Host)
+	}
+	if at, colon := strings.Index(location, "@"), strings.Index(location, ":"); colon > at+1 && !strings.Contains(location[:colon], "/") {
+		return strings.ToLower(location[at+1 : colon])
+	}
+	return ""
+}
+
+// resolveJobs returns the overall and per-host concurrency from the options, falling back to the configuration
+func resolveJobs(cfg *config.Config, opts Options) (int, int) {
+	jobs := opts.Jobs
+	if jobs <= 0 {
+		jobs = cfg.Concurrency
+	}
+	if jobs <= 0 {
+		jobs = defaultJobs
+	}
+
+	perHost := opts.PerHostJobs
+	if perHost <= 0 {
+		perHost = cfg.PerHostConcurrency
+	}
+
+	return jobs, perHost
+}
+
+// forEachRule calls fn for every rule in parallel and waits until all calls have returned.
+// Each call receives the index of the rule so that results can be collected in configuration order.
+// The per-host limit applies to the host the rule is fetched from; local rules only count against the overall limit.
+func (r *runner) forEachRule(cfg *config.Config, opts Options, fn func(i int, rule config.Rule)) {
+	jobs, perHost := resolveJobs(cfg, opts)
+	pool := newWorkerPool(jobs, perHost)
+
+	var wg sync.WaitGroup
+	for i, rule := range cfg.Rules {
+		wg.Add(1)
+		go func(i int, rule config.Rule) {
+			defer wg.Done()
+			release := pool.acquire(r.fetchHost(rule))
+			defer release()
+			fn(i, rule)
+		}(i, rule)
+	}
+	wg.Wait()
+}
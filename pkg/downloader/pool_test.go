@@ -0,0 +1,202 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestResolveJobs(t *testing.T) {
+	testCases := []struct {
+		name            string
+		cfg             config.Config
+		opts            Options
+		expectedJobs    int
+		expectedPerHost int
+	}{
+		{"Defaults", config.Config{}, Options{}, defaultJobs, 0},
+		{"Configuration", config.Config{Concurrency: 8, PerHostConcurrency: 2}, Options{}, 8, 2},
+		{"Flags override configuration", config.Config{Concurrency: 8, PerHostConcurrency: 2}, Options{Jobs: 3, PerHostJobs: 1}, 3, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			jobs, perHost := resolveJobs(&tc.cfg, tc.opts)
+			if jobs != tc.expectedJobs || perHost != tc.expectedPerHost {
+				t.Errorf("Expected: %d/%d, Actual: %d/%d", tc.expectedJobs, tc.expectedPerHost, jobs, perHost)
+			}
+		})
+	}
+}
+
+func TestWorkerPoolLimits(t *testing.T) {
+	pool := newWorkerPool(4, 2)
+
+	var mu sync.Mutex
+	running := map[string]int{}
+	maxPerHost := map[string]int{}
+	var total, maxTotal int32
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		host := fmt.Sprintf("host-%d", i%3)
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			release := pool.acquire(host)
+			defer release()
+
+			current := atomic.AddInt32(&total, 1)
+			for {
+				observed := atomic.LoadInt32(&maxTotal)
+				if current <= observed || atomic.CompareAndSwapInt32(&maxTotal, observed, current) {
+					break
+				}
+			}
+			mu.Lock()
+			running[host]++
+			if running[host] > maxPerHost[host] {
+				maxPerHost[host] = running[host]
+			}
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running[host]--
+			mu.Unlock()
+			atomic.AddInt32(&total, -1)
+		}(host)
+	}
+	wg.Wait()
+
+	if maxTotal > 4 {
+		t.Errorf("More tasks ran at once than allowed. Expected at most: 4, Actual: %d", maxTotal)
+	}
+	for host, max := range maxPerHost {
+		if max > 2 {
+			t.Errorf("More tasks ran at once for %s than allowed. Expected at most: 2, Actual: %d", host, max)
+		}
+	}
+}
+
+func TestDownloadAllRulesConcurrent(t *testing.T) {
+	var inFlight, maxInFlight int32
+
+	// Create HTTP test server that responds slowly so downloads overlap
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			observed := atomic.LoadInt32(&maxInFlight)
+			if current <= observed || atomic.CompareAndSwapInt32(&maxInFlight, observed, current) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		if r.URL.Path == "/error" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "concurrent-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{Path: filepath.Join(tempDir, "currm.yaml")}
+	for i := 0; i < 10; i++ {
+		path := fmt.Sprintf("/rule%d", i)
+		if i == 4 {
+			path = "/error"
+		}
+		cfg.Rules = append(cfg.Rules, config.Rule{Name: fmt.Sprintf("rule%d", i), URL: server.URL + path})
+	}
+
+	var pullErr *PullError
+	if err := DownloadAllRules(cfg, Options{Jobs: 3, KeepGoing: true}); !errors.As(err, &pullErr) {
+		t.Fatalf("DownloadAllRules function did not return a PullError: %v", err)
+	}
+
+	if maxInFlight > 3 {
+		t.Errorf("More downloads ran at once than allowed. Expected at most: 3, Actual: %d", maxInFlight)
+	}
+	if maxInFlight < 2 {
+		t.Errorf("Downloads did not run in parallel. Maximum in flight: %d", maxInFlight)
+	}
+
+	// The failing rule must not prevent the others from being installed,
+	// and the lockfile must list them in configuration order
+	lock, err := lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if len(lock.Rules) != 9 {
+		t.Fatalf("Expected number of locked rules: 9, Actual: %d", len(lock.Rules))
+	}
+	expected := []string{"rule0", "rule1", "rule2", "rule3", "rule5", "rule6", "rule7", "rule8", "rule9"}
+	for i, name := range expected {
+		if lock.Rules[i].Name != name {
+			t.Errorf("Locked rule %d does not match. Expected: %s, Actual: %s", i, name, lock.Rules[i].Name)
+		}
+	}
+}
+
+func TestFetchHost(t *testing.T) {
+	r, err := newRunner(&config.Config{}, Options{}, "")
+	if err != nil {
+		t.Fatalf("newRunner function returned an error: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		rule     config.Rule
+		expected string
+	}{
+		{"GitHub file page", config.Rule{Name: "r", URL: "https://github.com/owner/repo/blob/main/go.mdc"}, "raw.githubusercontent.com"},
+		{"GitHub raw URL", config.Rule{Name: "r", URL: "https://raw.githubusercontent.com/owner/repo/main/go.mdc"}, "raw.githubusercontent.com"},
+		{"Plain URL", config.Rule{Name: "r", URL: "https://Example.com/go.mdc"}, "example.com"},
+		{"Local path", config.Rule{Name: "r", Path: "go.mdc"}, ""},
+		{"File URL", config.Rule{Name: "r", URL: "file:///rules/go.mdc"}, ""},
+		{"Git repository URL", config.Rule{Name: "r", Git: &config.GitSource{Repo: "https://git.example.com/rules.git", Path: "go.mdc"}}, "git.example.com"},
+		{"scp-like git address", config.Rule{Name: "r", Git: &config.GitSource{Repo: "git@git.example.com:owner/rules.git", Path: "go.mdc"}}, "git.example.com"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := r.fetchHost(tc.rule); actual != tc.expected {
+				t.Errorf("Host does not match. Expected: %s, Actual: %s", tc.expected, actual)
+			}
+		})
+	}
+}
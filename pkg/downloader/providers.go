@@ -0,0 +1,563 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/guchey/currm/pkg/auth"
+	"github.com/guchey/currm/pkg/config"
+)
+
+// providerSources are the sources of git hosting providers that can also serve self-hosted instances
+var providerSources = map[string]Source{
+	"github":    githubSource{},
+	"gitlab":    gitlabSource{},
+	"bitbucket": bitbucketSource{},
+	"gitea":     giteaSource{},
+	"forgejo":   giteaSource{},
+}
+
+// providerHosts returns the sources for the hosts of self-hosted providers listed in the configuration
+func providerHosts(providers map[string][]string) (map[string]Source, error) {
+	hosts := make(map[string]Source)
+	for provider, list := range providers {
+		source, ok := providerSources[strings.ToLower(provider)]
+		if !ok {
+			names := make([]string, 0, len(providerSources))
+			for name := range providerSources {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown provider '%s' in configuration; use one of %s", provider, strings.Join(names, ", "))
+		}
+		for _, host := range list {
+			hosts[strings.ToLower(host)] = source
+		}
+	}
+	return hosts, nil
+}
+
+// hasRevision reports whether the rule asks for a specific revision
+func hasRevision(rule config.Rule) bool {
+	return rule.Revision != "" && rule.Revision != "latest"
+}
+
+// revisionError reports that the revision of the rule cannot be applied to its URL
+func revisionError(rule config.Rule, reason string) error {
+	return fmt.Errorf("cannot apply revision '%s' of rule '%s' to '%s': %s", rule.Revision, rule.Name, auth.Redact(rule.URL), reason)
+}
+
+// urlSegments parses the URL of the rule and splits its path into segments
+func urlSegments(rule config.Rule) (*url.URL, []string, error) {
+	u, err := url.Parse(rule.URL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid URL for rule '%s': %w", rule.Name, err)
+	}
+	return u, strings.Split(strings.Trim(u.Path, "/"), "/"), nil
+}
+
+// joinSegments returns the URL with its path replaced by the segments
+func joinSegments(u *url.URL, segments []string) string {
+	u.Path = "/" + strings.Join(segments, "/")
+	u.RawPath = ""
+	return u.String()
+}
+
+// githubSource fetches rules from GitHub and GitHub Enterprise.
+// Links to files on web pages are turned into raw content URLs and the revision is applied.
+type githubSource struct {
+	httpSource
+}
+
+// Resolve returns the raw URL of the rule with the revision applied
+func (githubSource) Resolve(rule config.Rule) (string, error) {
+	u, segments, err := urlSegments(rule)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case !hasRevision(rule) && (strings.HasPrefix(u.Hostname(), "raw.") || segments[0] == "raw"):
+		// Raw URLs are used as they are
+		return rule.URL, nil
+	case strings.HasPrefix(u.Hostname(), "raw.") && len(segments) >= 4:
+		// https://raw.githubusercontent.com/owner/repo/ref/path/to/file
+		segments[2] = rule.Revision
+	case u.Hostname() != "github.com" && segments[0] == "raw" && len(segments) >= 5:
+		// https://github.example.com/raw/owner/repo/ref/path/to/file
+		segments[3] = rule.Revision
+	case len(segments) >= 5 && (segments[2] == "blob" || segments[2] == "tree" || segments[2] == "raw"):
+		// https://github.com/owner/repo/blob/ref/path/to/file, also with ?raw=1 or ?plain=1
+		if hasRevision(rule) {
+			segments[3] = rule.Revision
+		}
+		u.RawQuery = ""
+		u.Fragment = ""
+		if u.Hostname() == "github.com" {
+			u.Host = "raw.githubusercontent.com"
+			segments = append(segments[:2:2], segments[3:]...)
+		} else {
+			// GitHub Enterprise redirects /owner/repo/raw/ref/path to the raw content
+			segments[2] = "raw"
+		}
+	case hasRevision(rule):
+		return "", revisionError(rule, "expected a GitHub file URL such as https://raw.githubusercontent.com/owner/repo/ref/path")
+	default:
+		return rule.URL, nil
+	}
+	return joinSegments(u, segments), nil
+}
+
+// Fetch resolves the ref in the URL to a commit with the GitHub API and downloads the rule at that commit.
+// If the API cannot be used, the rule is downloaded at the ref and no commit is reported.
+func (githubSource) Fetch(req *FetchRequest) (*FetchResult, error) {
+	raw, ok := parseGitHubRaw(req.Location)
+	if !ok {
+		return fetchContent(req.Client, req.Rule, req.Location, req.Validators)
+	}
+
+	commit := req.Revision
+	ref := raw.segments[raw.ref]
+	if commit == "" && len(ref) == 40 && isHexString(ref) {
+		commit = strings.ToLower(ref)
+	}
+	if commit == "" {
+		// Rules from the same repository and ref share a single API request
+		apiURL := githubAPIURL(req.Config, raw.url)
+		commit, _ = req.commits.resolve(apiURL+"/"+raw.owner+"/"+raw.repo+"@"+ref, func() (string, error) {
+			commit, err := resolveGitHubCommit(req.Client, apiURL, raw.owner, raw.repo, ref)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: %v; rules from it are installed at the ref and no commit is recorded\n", err)
+			}
+			return commit, err
+		})
+	}
+
+	location := req.Location
+	if commit != "" {
+		raw.segments[raw.ref] = commit
+		location = joinSegments(raw.url, raw.segments)
+	}
+
+	result, err := fetchContent(req.Client, req.Rule, location, req.Validators)
+	if err != nil {
+		return nil, err
+	}
+	result.Revision = commit
+	return result, nil
+}
+
+// githubRaw is a raw GitHub URL split into the parts needed to pin it to a commit
+type githubRaw struct {
+	url      *url.URL
+	segments []string
+	owner    string
+	repo     string
+	// ref is the index of the segment that holds the ref
+	ref int
+}
+
+// parseGitHubRaw splits a raw GitHub URL, reporting false for other URLs
+func parseGitHubRaw(location string) (*githubRaw, bool) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, false
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+
+	switch {
+	case strings.HasPrefix(u.Hostname(), "raw.") && len(segments) >= 4:
+		// https://raw.githubusercontent.com/owner/repo/ref/path/to/file
+		return &githubRaw{url: u, segments: segments, owner: segments[0], repo: segments[1], ref: 2}, true
+	case u.Hostname() != "github.com" && segments[0] == "raw" && len(segments) >= 5:
+		// https://github.example.com/raw/owner/repo/ref/path/to/file
+		return &githubRaw{url: u, segments: segments, owner: segments[1], repo: segments[2], ref: 3}, true
+	case len(segments) >= 5 && segments[2] == "raw":
+		// https://github.example.com/owner/repo/raw/ref/path/to/file
+		return &githubRaw{url: u, segments: segments, owner: segments[0], repo: segments[1], ref: 3}, true
+	}
+	return nil, false
+}
+
+// githubAPIURL returns the base URL of the GitHub API that serves the host of u
+func githubAPIURL(cfg *config.Config, u *url.URL) string {
+	if cfg != nil && cfg.GitHubAPIURL != "" {
+		return strings.TrimSuffix(cfg.GitHubAPIURL, "/")
+	}
+
+	host := strings.TrimPrefix(u.Host, "raw.")
+	if host == "github.com" || host == "githubusercontent.com" {
+		return "https://api.github.com"
+	}
+	return u.Scheme + "://" + host + "/api/v3"
+}
+
+// commitCache remembers the commits refs resolved to during a run
+type commitCache struct {
+	mu      sync.Mutex
+	lookups map[string]*commitLookup
+}
+
+// commitLookup is the resolution of a single ref, shared by every rule that asks for it
+type commitLookup struct {
+	once   sync.Once
+	commit string
+	err    error
+}
+
+// resolve returns the commit for key, calling lookup only the first time the key is asked for.
+// A nil cache calls lookup every time.
+func (c *commitCache) resolve(key string, lookup func() (string, error)) (string, error) {
+	if c == nil {
+		return lookup()
+	}
+
+	c.mu.Lock()
+	if c.lookups == nil {
+		c.lookups = make(map[string]*commitLookup)
+	}
+	l, ok := c.lookups[key]
+	if !ok {
+		l = &commitLookup{}
+		c.lookups[key] = l
+	}
+	c.mu.Unlock()
+
+	l.once.Do(func() {
+		l.commit, l.err = lookup()
+	})
+	return l.commit, l.err
+}
+
+// resolveGitHubCommit asks the GitHub commits API for the commit that ref points to
+func resolveGitHubCommit(client *http.Client, apiURL string, owner string, repo string, ref string) (string, error) {
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/commits/%s", apiURL, url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(ref))
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request for '%s': %w", endpoint, err)
+	}
+	// Ask for the bare SHA instead of the full commit object
+	req.Header.Set("Accept", "application/vnd.github.sha")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve '%s' of %s/%s: %w", ref, owner, repo, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to resolve '%s' of %s/%s: HTTP status code %d", ref, owner, repo, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", fmt.Errorf("failed to read commit of '%s': %w", ref, err)
+	}
+
+	commit := strings.ToLower(strings.TrimSpace(string(body)))
+	if len(commit) != 40 || !isHexString(commit) {
+		return "", fmt.Errorf("unexpected response when resolving '%s' of %s/%s", ref, owner, repo)
+	}
+	return commit, nil
+}
+
+// Tags lists the tags of the repository of the rule with the GitHub tags API
+func (githubSource) Tags(req *FetchRequest) ([]string, error) {
+	rule := req.Rule
+	rule.Revision = ""
+	location, err := githubSource{}.Resolve(rule)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := parseGitHubRaw(location)
+	if !ok {
+		return nil, fmt.Errorf("cannot list tags for rule '%s': expected a GitHub file URL such as https://raw.githubusercontent.com/owner/repo/ref/path", rule.Name)
+	}
+
+	var tags []string
+	next := fmt.Sprintf("%s/repos/%s/%s/tags?per_page=100", githubAPIURL(req.Config, raw.url), url.PathEscape(raw.owner), url.PathEscape(raw.repo))
+	for next != "" {
+		resp, err := req.Client.Get(next)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list tags of %s/%s: %w", raw.owner, raw.repo, err)
+		}
+
+		var page []struct {
+			Name string `json:"name"`
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to list tags of %s/%s: HTTP status code %d", raw.owner, raw.repo, resp.StatusCode)
+		}
+		err = json.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tags of %s/%s: %w", raw.owner, raw.repo, err)
+		}
+
+		for _, tag := range page {
+			tags = append(tags, tag.Name)
+		}
+		next = nextPage(resp.Header.Get("Link"))
+	}
+	return tags, nil
+}
+
+// ListDir lists the files under a GitHub directory URL such as https://github.com/owner/repo/tree/ref/path
+// with the GitHub trees API. The files are linked at the ref of the URL so that the revision of the rule applies to them.
+func (githubSource) ListDir(req *FetchRequest) ([]config.Rule, error) {
+	rule := req.Rule
+	u, segments, err := urlSegments(rule)
+	if err != nil {
+		return nil, err
+	}
+
+	// https://github.com/owner/repo lists the default branch
+	ref, dir := "HEAD", ""
+	switch {
+	case len(segments) == 2 && segments[0] != "":
+	case len(segments) >= 4 && (segments[2] == "tree" || segments[2] == "blob"):
+		ref, dir = segments[3], strings.Join(segments[4:], "/")
+	default:
+		return nil, fmt.Errorf("cannot list the directory of rule '%s': expected a GitHub directory URL such as https://github.com/owner/repo/tree/ref/path", rule.Name)
+	}
+	owner, repo := segments[0], segments[1]
+
+	listRef := ref
+	if hasRevision(rule) {
+		listRef = rule.Revision
+	}
+
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/git/trees/%s?recursive=1", githubAPIURL(req.Config, u), url.PathEscape(owner), url.PathEscape(repo), url.PathEscape(listRef))
+	resp, err := req.Client.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files of %s/%s: %w", owner, repo, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list files of %s/%s at '%s': HTTP status code %d", owner, repo, listRef, resp.StatusCode)
+	}
+
+	var tree struct {
+		Tree []struct {
+			Path string `json:"path"`
+			Type string `json:"type"`
+		} `json:"tree"`
+		Truncated bool `json:"truncated"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tree); err != nil {
+		return nil, fmt.Errorf("failed to parse files of %s/%s: %w", owner, repo, err)
+	}
+	if tree.Truncated {
+		return nil, fmt.Errorf("%s/%s has too many files to list with the GitHub API; import the directory with a git source instead", owner, repo)
+	}
+
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+
+	var files []config.Rule
+	for _, entry := range tree.Tree {
+		if entry.Type != "blob" || !strings.HasPrefix(entry.Path, prefix) {
+			continue
+		}
+		fileURL := *u
+		files = append(files, config.Rule{
+			Name: strings.TrimPrefix(entry.Path, prefix),
+			URL:  joinSegments(&fileURL, append([]string{owner, repo, "blob", ref}, strings.Split(entry.Path, "/")...)),
+		})
+	}
+	return files, nil
+}
+
+// nextPage returns the URL of the next page from a Link header of the GitHub API, or an empty string on the last page
+func nextPage(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		target, params, ok := strings.Cut(part, ";")
+		if ok && strings.Contains(params, `rel="next"`) {
+			return strings.Trim(strings.TrimSpace(target), "<>")
+		}
+	}
+	return ""
+}
+
+// gistSource fetches rules from GitHub Gists, turning links to gist pages into raw content URLs
+type gistSource struct {
+	httpSource
+}
+
+// Resolve returns the raw URL of the gist with the revision applied
+func (gistSource) Resolve(rule config.Rule) (string, error) {
+	u, segments, err := urlSegments(rule)
+	if err != nil {
+		return "", err
+	}
+
+	// https://gist.github.com/user/id and https://gist.github.com/user/id/raw/rev/file
+	if u.Hostname() == "gist.github.com" && len(segments) == 2 {
+		if hasRevision(rule) {
+			return "", revisionError(rule, "expected a raw gist URL with a file name such as https://gist.githubusercontent.com/user/id/raw/rev/file")
+		}
+		u.Host = "gist.githubusercontent.com"
+		u.RawQuery = ""
+		u.Fragment = ""
+		return joinSegments(u, append(segments, "raw")), nil
+	}
+
+	if len(segments) < 5 || segments[2] != "raw" {
+		if hasRevision(rule) {
+			return "", revisionError(rule, "expected a raw gist URL with a file name such as https://gist.githubusercontent.com/user/id/raw/rev/file")
+		}
+		return rule.URL, nil
+	}
+
+	u.Host = "gist.githubusercontent.com"
+	if hasRevision(rule) {
+		segments[3] = rule.Revision
+	}
+	return joinSegments(u, segments), nil
+}
+
+// gitlabSource fetches rules from GitLab.
+// Links to files on web pages are turned into raw content URLs and the revision is applied.
+type gitlabSource struct {
+	httpSource
+}
+
+// Resolve returns the raw URL of the rule with the revision applied
+func (gitlabSource) Resolve(rule config.Rule) (string, error) {
+	u, segments, err := urlSegments(rule)
+	if err != nil {
+		return "", err
+	}
+
+	// https://gitlab.com/group/subgroup/project/-/raw/ref/path/to/file
+	for i := 2; i+3 < len(segments); i++ {
+		if segments[i] == "-" && (segments[i+1] == "raw" || segments[i+1] == "blob") {
+			if segments[i+1] == "raw" && !hasRevision(rule) {
+				return rule.URL, nil
+			}
+			if segments[i+1] == "blob" {
+				segments[i+1] = "raw"
+				u.RawQuery = ""
+				u.Fragment = ""
+			}
+			if hasRevision(rule) {
+				segments[i+2] = rule.Revision
+			}
+			return joinSegments(u, segments), nil
+		}
+	}
+
+	if hasRevision(rule) {
+		return "", revisionError(rule, "expected a GitLab file URL such as https://gitlab.com/group/project/-/raw/ref/path")
+	}
+	return rule.URL, nil
+}
+
+// bitbucketSource fetches rules from Bitbucket Cloud and Bitbucket Server.
+// Links to files on web pages are turned into raw content URLs and the revision is applied.
+type bitbucketSource struct {
+	httpSource
+}
+
+// Resolve returns the raw URL of the rule with the revision applied
+func (bitbucketSource) Resolve(rule config.Rule) (string, error) {
+	u, segments, err := urlSegments(rule)
+	if err != nil {
+		return "", err
+	}
+
+	// Bitbucket Server takes the revision as a query parameter:
+	// https://bitbucket.example.com/projects/KEY/repos/repo/raw/path/to/file?at=ref
+	for i := 0; i+3 < len(segments); i++ {
+		if segments[i] == "repos" && (segments[i+2] == "raw" || segments[i+2] == "browse") {
+			if segments[i+2] == "raw" && !hasRevision(rule) {
+				return rule.URL, nil
+			}
+			segments[i+2] = "raw"
+			if hasRevision(rule) {
+				query := u.Query()
+				query.Set("at", rule.Revision)
+				u.RawQuery = query.Encode()
+			}
+			return joinSegments(u, segments), nil
+		}
+	}
+
+	// https://bitbucket.org/owner/repo/raw/ref/path/to/file
+	if len(segments) >= 5 && (segments[2] == "raw" || segments[2] == "src") {
+		if segments[2] == "raw" && !hasRevision(rule) {
+			return rule.URL, nil
+		}
+		segments[2] = "raw"
+		if hasRevision(rule) {
+			segments[3] = rule.Revision
+		}
+		return joinSegments(u, segments), nil
+	}
+
+	if hasRevision(rule) {
+		return "", revisionError(rule, "expected a Bitbucket file URL such as https://bitbucket.org/owner/repo/raw/ref/path")
+	}
+	return rule.URL, nil
+}
+
+// giteaSource fetches rules from Gitea and Forgejo.
+// Links to files on web pages are turned into raw content URLs and the revision is applied.
+type giteaSource struct {
+	httpSource
+}
+
+// Resolve returns the raw URL of the rule with the revision applied
+func (giteaSource) Resolve(rule config.Rule) (string, error) {
+	u, segments, err := urlSegments(rule)
+	if err != nil {
+		return "", err
+	}
+
+	// https://codeberg.org/owner/repo/raw/branch/ref/path/to/file
+	if len(segments) < 5 || (segments[2] != "raw" && segments[2] != "src" && segments[2] != "media") {
+		if hasRevision(rule) {
+			return "", revisionError(rule, "expected a Gitea file URL such as https://codeberg.org/owner/repo/raw/branch/ref/path")
+		}
+		return rule.URL, nil
+	}
+	if !hasRevision(rule) {
+		if segments[2] != "src" {
+			return rule.URL, nil
+		}
+		segments[2] = "raw"
+		return joinSegments(u, segments), nil
+	}
+	segments[2] = "raw"
+
+	path := segments[4:]
+	switch segments[3] {
+	case "branch", "tag", "commit":
+		if len(segments) < 6 {
+			return "", revisionError(rule, "the URL has no file path")
+		}
+		path = segments[5:]
+	}
+
+	// A revision can be a branch, a tag or a commit; Gitea looks the ref up itself without the kind
+	ref := []string{rule.Revision}
+	if len(rule.Revision) == 40 && isHexString(rule.Revision) {
+		ref = []string{"commit", rule.Revision}
+	}
+
+	resolved := append(append(append([]string{}, segments[:3]...), ref...), path...)
+	return joinSegments(u, resolved), nil
+}
@@ -0,0 +1,297 @@
+package downloader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestProviderResolve(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+
+	tests := []struct {
+		name     string
+		source   Source
+		url      string
+		revision string
+		expected string
+		wantErr  bool
+	}{
+		// GitHub
+		{name: "github raw", source: githubSource{}, url: "https://raw.githubusercontent.com/owner/repo/main/rules/a.mdc", revision: "v1", expected: "https://raw.githubusercontent.com/owner/repo/v1/rules/a.mdc"},
+		{name: "github blob", source: githubSource{}, url: "https://github.com/owner/repo/blob/main/a.mdc", revision: sha, expected: "https://raw.githubusercontent.com/owner/repo/" + sha + "/a.mdc"},
+		{name: "github blob with raw query", source: githubSource{}, url: "https://github.com/owner/repo/blob/main/rules/a.mdc?raw=1", expected: "https://raw.githubusercontent.com/owner/repo/main/rules/a.mdc"},
+		{name: "github tree", source: githubSource{}, url: "https://github.com/owner/repo/tree/main/a.mdc", expected: "https://raw.githubusercontent.com/owner/repo/main/a.mdc"},
+		{name: "github raw unchanged", source: githubSource{}, url: "https://raw.githubusercontent.com/owner/repo/main/a.mdc?token=abc", expected: "https://raw.githubusercontent.com/owner/repo/main/a.mdc?token=abc"},
+		{name: "github latest", source: githubSource{}, url: "https://github.com/owner/repo", revision: "latest", expected: "https://github.com/owner/repo"},
+		{name: "github repository", source: githubSource{}, url: "https://github.com/owner/repo", revision: "v1", wantErr: true},
+		{name: "github enterprise", source: githubSource{}, url: "https://github.example.com/raw/owner/repo/main/a.mdc", revision: "v1", expected: "https://github.example.com/raw/owner/repo/v1/a.mdc"},
+		{name: "github enterprise blob", source: githubSource{}, url: "https://github.example.com/owner/repo/blob/main/a.mdc", revision: "v1", expected: "https://github.example.com/owner/repo/raw/v1/a.mdc"},
+		// Gists
+		{name: "gist page", source: gistSource{}, url: "https://gist.github.com/user/abc123", expected: "https://gist.githubusercontent.com/user/abc123/raw"},
+		{name: "gist raw", source: gistSource{}, url: "https://gist.github.com/user/abc123/raw/def456/a.mdc", revision: "fed654", expected: "https://gist.githubusercontent.com/user/abc123/raw/fed654/a.mdc"},
+		{name: "gist page with revision", source: gistSource{}, url: "https://gist.github.com/user/abc123", revision: "fed654", wantErr: true},
+		// GitLab
+		{name: "gitlab raw", source: gitlabSource{}, url: "https://gitlab.com/group/sub/project/-/raw/main/a.mdc?inline=false", revision: "v1", expected: "https://gitlab.com/group/sub/project/-/raw/v1/a.mdc?inline=false"},
+		{name: "gitlab blob", source: gitlabSource{}, url: "https://gitlab.com/group/project/-/blob/main/a.mdc", revision: "v1", expected: "https://gitlab.com/group/project/-/raw/v1/a.mdc"},
+		{name: "gitlab project", source: gitlabSource{}, url: "https://gitlab.com/group/project", revision: "v1", wantErr: true},
+		// Bitbucket
+		{name: "bitbucket raw", source: bitbucketSource{}, url: "https://bitbucket.org/owner/repo/raw/main/a.mdc", revision: "v1", expected: "https://bitbucket.org/owner/repo/raw/v1/a.mdc"},
+		{name: "bitbucket src", source: bitbucketSource{}, url: "https://bitbucket.org/owner/repo/src/main/a.mdc", expected: "https://bitbucket.org/owner/repo/raw/main/a.mdc"},
+		{name: "bitbucket server", source: bitbucketSource{}, url: "https://bitbucket.example.com/projects/KEY/repos/repo/raw/a.mdc", revision: "v1", expected: "https://bitbucket.example.com/projects/KEY/repos/repo/raw/a.mdc?at=v1"},
+		{name: "bitbucket repository", source: bitbucketSource{}, url: "https://bitbucket.org/owner/repo", revision: "v1", wantErr: true},
+		// Gitea and Forgejo
+		{name: "gitea branch", source: giteaSource{}, url: "https://codeberg.org/owner/repo/raw/branch/main/a.mdc", revision: "v1", expected: "https://codeberg.org/owner/repo/raw/v1/a.mdc"},
+		{name: "gitea commit", source: giteaSource{}, url: "https://codeberg.org/owner/repo/raw/branch/main/a.mdc", revision: sha, expected: "https://codeberg.org/owner/repo/raw/commit/" + sha + "/a.mdc"},
+		{name: "gitea src", source: giteaSource{}, url: "https://codeberg.org/owner/repo/src/branch/main/a.mdc", expected: "https://codeberg.org/owner/repo/raw/branch/main/a.mdc"},
+		{name: "gitea without path", source: giteaSource{}, url: "https://codeberg.org/owner/repo/raw/branch/main", revision: "v1", wantErr: true},
+		// Unknown hosts
+		{name: "plain URL", source: httpSource{}, url: "https://example.com/a.mdc", revision: "v1", wantErr: true},
+		{name: "plain URL without revision", source: httpSource{}, url: "https://example.com/a.mdc", expected: "https://example.com/a.mdc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := tt.source.Resolve(config.Rule{Name: "rule", URL: tt.url, Revision: tt.revision})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("No error was returned. Actual: %s", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve returned an error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("URL does not match. Expected: %s, Actual: %s", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestConfiguredProviders(t *testing.T) {
+	cfg := &config.Config{Providers: map[string][]string{"github": {"GitHub.Example.com"}, "gitlab": {"git.example.com:8443"}}}
+	r, err := newRunner(cfg, Options{}, "")
+	if err != nil {
+		t.Fatalf("newRunner returned an error: %v", err)
+	}
+
+	resolved, err := r.resolve(config.Rule{Name: "ghe", URL: "https://github.example.com/owner/repo/blob/main/a.mdc", Revision: "v1"}, "")
+	if err != nil {
+		t.Fatalf("resolve returned an error: %v", err)
+	}
+	if resolved.location != "https://github.example.com/owner/repo/raw/v1/a.mdc" {
+		t.Errorf("URL does not match. Expected: %s, Actual: %s", "https://github.example.com/owner/repo/raw/v1/a.mdc", resolved.location)
+	}
+
+	// Hosts can be listed with their port
+	resolved, err = r.resolve(config.Rule{Name: "gitlab", URL: "https://git.example.com:8443/group/project/-/raw/main/a.mdc", Revision: "v1"}, "")
+	if err != nil {
+		t.Fatalf("resolve returned an error: %v", err)
+	}
+	if resolved.location != "https://git.example.com:8443/group/project/-/raw/v1/a.mdc" {
+		t.Errorf("URL does not match. Expected: %s, Actual: %s", "https://git.example.com:8443/group/project/-/raw/v1/a.mdc", resolved.location)
+	}
+
+	// Unknown providers are rejected
+	cfg.Providers = map[string][]string{"sourcehut": {"git.sr.ht"}}
+	if _, err := newRunner(cfg, Options{}, ""); err == nil {
+		t.Error("No error was returned for an unknown provider")
+	}
+}
+
+func TestGitHubCommitResolution(t *testing.T) {
+	first := "1111111111111111111111111111111111111111"
+	second := "2222222222222222222222222222222222222222"
+	contents := map[string]string{first: "first version", second: "second version"}
+
+	// Create HTTP test server that stands in for a GitHub Enterprise host and its API
+	var mu sync.Mutex
+	head := first
+	apiFails := false
+	apiRequests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.URL.Path == "/api/repos/owner/repo/commits/main":
+			apiRequests++
+			if apiFails {
+				w.Header().Set("X-RateLimit-Remaining", "0")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			if r.Header.Get("Accept") != "application/vnd.github.sha" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(head))
+		case strings.HasPrefix(r.URL.Path, "/owner/repo/raw/main/"):
+			w.Write([]byte(contents[head]))
+		case strings.HasPrefix(r.URL.Path, "/owner/repo/raw/"):
+			commit := strings.Split(r.URL.Path, "/")[4]
+			content, ok := contents[commit]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write([]byte(content))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "github-commit-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules:        []config.Rule{{Name: "rule", URL: server.URL + "/owner/repo/blob/main/rule.mdc", Revision: "latest"}},
+		Path:         filepath.Join(tempDir, "currm.yaml"),
+		GitHubAPIURL: server.URL + "/api",
+		Providers:    map[string][]string{"github": {"127.0.0.1"}},
+	}
+	opts := Options{CacheDir: filepath.Join(tempDir, "cache")}
+
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	// Rules from the same repository and ref share the API request
+	other := cfg.Rules[0]
+	other.Name = "other"
+	other.URL = server.URL + "/owner/repo/blob/main/other.mdc"
+	cfg.Rules = append(cfg.Rules, other)
+	mu.Lock()
+	apiRequests = 0
+	mu.Unlock()
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	if apiRequests != 1 {
+		t.Errorf("Number of API requests does not match. Expected: %d, Actual: %d", 1, apiRequests)
+	}
+
+	// The lockfile records the commit the branch pointed to
+	lock, err := lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if locked := lock.Find("rule"); locked == nil || locked.ResolvedCommit != first {
+		t.Fatalf("Resolved commit was not locked. Expected: %s, Actual: %+v", first, locked)
+	}
+
+	// check reports the installed commit and the one the branch moved to
+	mu.Lock()
+	head = second
+	mu.Unlock()
+	statuses, err := CheckRuleUpdates(cfg, opts)
+	if err != nil {
+		t.Fatalf("CheckRuleUpdates function returned an error: %v", err)
+	}
+	if statuses[0].InstalledCommit != first || statuses[0].UpstreamCommit != second {
+		t.Errorf("Commits do not match. Expected: %s -> %s, Actual: %s -> %s", first, second, statuses[0].InstalledCommit, statuses[0].UpstreamCommit)
+	}
+	if statuses[0].State != StateUpstreamChanged {
+		t.Errorf("State of rule does not match. Expected: %s, Actual: %s", StateUpstreamChanged, statuses[0].State)
+	}
+
+	// A frozen install fetches the locked commit even though the branch moved
+	filePath := filepath.Join(tempDir, ".cursor", "rules", "rule.mdc")
+	if err := DownloadAllRules(cfg, Options{CacheDir: opts.CacheDir, Frozen: true}); err != nil {
+		t.Fatalf("Frozen install returned an error: %v", err)
+	}
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "first version" {
+		t.Errorf("Frozen install did not use the locked commit. Expected: %s, Actual: %s", "first version", string(content))
+	}
+
+	// Without the API, the rule is still installed from the branch but no commit is recorded
+	mu.Lock()
+	apiFails = true
+	mu.Unlock()
+	if err := DownloadAllRules(cfg, opts); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	content, err = os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "second version" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "second version", string(content))
+	}
+	lock, err = lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if locked := lock.Find("rule"); locked == nil || locked.ResolvedCommit != "" {
+		t.Errorf("No commit should be locked without the API. Actual: %+v", locked)
+	}
+}
+
+func TestGitHubTags(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/tags" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// Tags are listed over two pages
+		if r.URL.Query().Get("page") == "" {
+			w.Header().Set("Link", `<`+server.URL+`/repos/owner/repo/tags?per_page=100&page=2>; rel="next", <`+server.URL+`/repos/owner/repo/tags?per_page=100&page=2>; rel="last"`)
+			w.Write([]byte(`[{"name":"v1.2.0"},{"name":"v2.0.0"}]`))
+			return
+		}
+		w.Write([]byte(`[{"name":"v1.3.0"}]`))
+	}))
+	defer server.Close()
+
+	req := &FetchRequest{
+		Rule:   config.Rule{Name: "tags", URL: "https://github.com/owner/repo/blob/main/a.mdc", Revision: "^1.2"},
+		Client: server.Client(),
+		Config: &config.Config{GitHubAPIURL: server.URL},
+	}
+	tags, err := githubSource{}.Tags(req)
+	if err != nil {
+		t.Fatalf("Tags returned an error: %v", err)
+	}
+	if strings.Join(tags, ",") != "v1.2.0,v2.0.0,v1.3.0" {
+		t.Errorf("Tags do not match. Expected: %s, Actual: %s", "v1.2.0,v2.0.0,v1.3.0", strings.Join(tags, ","))
+	}
+
+	// Sources that cannot list tags reject version ranges
+	r, err := newRunner(&config.Config{}, Options{}, "")
+	if err != nil {
+		t.Fatalf("newRunner returned an error: %v", err)
+	}
+	if _, err := r.resolve(config.Rule{Name: "plain", URL: "https://example.com/a.mdc", Revision: "^1.2"}, ""); err == nil {
+		t.Error("No error was returned for a version range on a source without tags")
+	}
+}
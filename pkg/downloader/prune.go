@@ -0,0 +1,143 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+// errModified is returned when an installed file was changed after currm wrote it
+var errModified = errors.New("modified since it was installed")
+
+// lockedFileName returns the name of the file installed for a locked rule.
+// Lockfiles written before the file was recorded derive it from the rule like the install did.
+func lockedFileName(locked lockfile.LockedRule) string {
+	if locked.File != "" {
+		return locked.File
+	}
+	return ruleFileName(config.Rule{Name: locked.Name, Revision: locked.Revision})
+}
+
+// orphanedFiles returns the files recorded in the previous lockfile that the new lockfile no longer installs
+func orphanedFiles(previous *lockfile.Lockfile, lock *lockfile.Lockfile) []lockfile.InstalledFile {
+	seen := make(map[string]bool)
+	for _, locked := range lock.Rules {
+		seen[lockedFileName(locked)] = true
+	}
+
+	var orphaned []lockfile.InstalledFile
+	candidates := append([]lockfile.InstalledFile{}, previous.Orphaned...)
+	for _, locked := range previous.Rules {
+		candidates = append(candidates, lockfile.InstalledFile{File: lockedFileName(locked), SHA256: locked.SHA256})
+	}
+	for _, file := range candidates {
+		if seen[file.File] {
+			continue
+		}
+		seen[file.File] = true
+		orphaned = append(orphaned, file)
+	}
+	return orphaned
+}
+
+// removeInstalled deletes a file currm installed in the rules directory, moving it into the backup of tx if it is set.
+// It returns false without an error if the file no longer exists, and errModified if it was changed since it was installed.
+func removeInstalled(rulesDir string, file lockfile.InstalledFile, tx *transaction) (bool, error) {
+	// The lockfile only records plain file names
+	filePath, err := confinePath(rulesDir, file.File)
+	if err != nil {
+		return false, err
+	}
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read file '%s': %w", filePath, err)
+	}
+	if sha256Hex(content) != file.SHA256 {
+		return false, errModified
+	}
+
+	if tx != nil {
+		return true, tx.remove(file.File)
+	}
+	if err := os.Remove(filePath); err != nil {
+		return false, fmt.Errorf("failed to remove file '%s': %w", filePath, err)
+	}
+	return true, nil
+}
+
+// pruneFiles deletes the orphaned files if prune is set and returns the ones that remain tracked.
+// Files that were modified by hand are kept and no longer tracked.
+func pruneFiles(rulesDir string, orphaned []lockfile.InstalledFile, prune bool, tx *transaction) []lockfile.InstalledFile {
+	var remaining []lockfile.InstalledFile
+	for _, file := range orphaned {
+		filePath := filepath.Join(rulesDir, file.File)
+		if !prune {
+			if _, err := os.Stat(filePath); err == nil {
+				remaining = append(remaining, file)
+			}
+			continue
+		}
+
+		removed, err := removeInstalled(rulesDir, file, tx)
+		switch {
+		case errors.Is(err, errModified):
+			fmt.Printf("Kept '%s': it was %v; delete it by hand if it is no longer needed\n", filePath, err)
+		case err != nil:
+			fmt.Printf("Warning: %v\n", err)
+			remaining = append(remaining, file)
+		case removed:
+			fmt.Printf("Removed '%s'\n", filePath)
+		}
+	}
+
+	if len(remaining) > 0 && !prune {
+		fmt.Printf("%d file(s) of removed or renamed rules remain in '%s'; run 'currm pull --prune' to delete them\n", len(remaining), rulesDir)
+	}
+	return remaining
+}
+
+// RemoveRule deletes the files installed for the named rule and drops it from the lockfile.
+// For a dir rule, the files of every rule imported from it are deleted.
+// Only files recorded in the lockfile are deleted, and only if they were not modified since they were installed.
+func RemoveRule(cfg *config.Config, name string) error {
+	lockPath := lockfile.PathFor(cfg.Path)
+	lock, err := lockfile.Load(lockPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		fmt.Printf("No installed files are recorded for rule '%s'\n", name)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rulesDir, err := projectRulesDir()
+	if err != nil {
+		return err
+	}
+
+	var kept []lockfile.LockedRule
+	var files []lockfile.InstalledFile
+	for _, locked := range lock.Rules {
+		if locked.Name == name || locked.From == name {
+			files = append(files, lockfile.InstalledFile{File: lockedFileName(locked), SHA256: locked.SHA256})
+			continue
+		}
+		kept = append(kept, locked)
+	}
+	if len(files) == 0 {
+		fmt.Printf("No installed files are recorded for rule '%s'\n", name)
+		return nil
+	}
+
+	lock.Rules = kept
+	lock.Orphaned = append(lock.Orphaned, pruneFiles(rulesDir, files, true, nil)...)
+	return lock.Save(lockPath)
+}
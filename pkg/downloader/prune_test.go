@@ -0,0 +1,182 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestDownloadAllRulesPrune(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "prune-rules-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	for _, name := range []string{"python.mdc", "shell.mdc"} {
+		if err := os.WriteFile(name, []byte("Rule "+name), 0644); err != nil {
+			t.Fatalf("Failed to write rule file: %v", err)
+		}
+	}
+	// Local files have no revisions; go comes from a source that applies them
+	RegisterSchemeSource("memory", memorySource{rules: map[string]string{"go@v1": "Go rule v1", "go@v2": "Go rule v2"}})
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "go", URL: "memory://go", Revision: "v1"},
+			{Name: "python", Path: "python.mdc"},
+			{Name: "shell", Path: "shell.mdc"},
+		},
+		Path: filepath.Join(tempDir, "currm.yaml"),
+	}
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	handWritten := filepath.Join(rulesDir, "mine.mdc")
+	if err := os.WriteFile(handWritten, []byte("Hand-written rule"), 0644); err != nil {
+		t.Fatalf("Failed to write hand-written rule: %v", err)
+	}
+
+	// A new revision renames the file of a rule; python is removed and shell is removed after a local edit
+	cfg.Rules = []config.Rule{{Name: "go", URL: "memory://go", Revision: "v2"}}
+	if err := os.WriteFile(filepath.Join(rulesDir, "shell.mdc"), []byte("Edited by hand"), 0644); err != nil {
+		t.Fatalf("Failed to edit installed rule: %v", err)
+	}
+
+	// Without pruning, the old files stay and are remembered in the lockfile
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	for _, name := range []string{"go-v1.mdc", "go-v2.mdc", "python.mdc", "shell.mdc"} {
+		if _, err := os.Stat(filepath.Join(rulesDir, name)); err != nil {
+			t.Errorf("File %s was removed without pruning: %v", name, err)
+		}
+	}
+	lock, err := lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if len(lock.Orphaned) != 3 {
+		t.Errorf("Number of orphaned files does not match. Expected: %d, Actual: %d", 3, len(lock.Orphaned))
+	}
+	if locked := lock.Find("go"); locked == nil || locked.File != "go-v2.mdc" {
+		t.Errorf("Installed file was not recorded in the lockfile. Actual: %+v", locked)
+	}
+
+	// Pruning deletes only the files currm installed and that were not edited since
+	if err := DownloadAllRules(cfg, Options{Prune: true}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	expected := map[string]bool{
+		"go-v1.mdc":  false,
+		"go-v2.mdc":  true,
+		"python.mdc": false,
+		"shell.mdc":  true,
+		"mine.mdc":   true,
+	}
+	for name, exists := range expected {
+		_, err := os.Stat(filepath.Join(rulesDir, name))
+		if (err == nil) != exists {
+			t.Errorf("Existence of %s does not match. Expected: %t, Actual: %t", name, exists, err == nil)
+		}
+	}
+	lock, err = lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if len(lock.Orphaned) != 0 {
+		t.Errorf("Orphaned files are still tracked after pruning: %+v", lock.Orphaned)
+	}
+
+	// A frozen install does not change the lockfile, so it cannot prune
+	if err := DownloadAllRules(cfg, Options{Frozen: true, Prune: true}); err == nil {
+		t.Error("No error was returned for pruning in a frozen install")
+	}
+}
+
+func TestRemoveRule(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "remove-rule-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	if err := os.WriteFile("go.mdc", []byte("Go rule"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "go", Path: "go.mdc"},
+			{Name: "other", Path: "go.mdc"},
+		},
+		Path: filepath.Join(tempDir, "currm.yaml"),
+	}
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	if err := RemoveRule(cfg, "go"); err != nil {
+		t.Fatalf("RemoveRule function returned an error: %v", err)
+	}
+
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	if _, err := os.Stat(filepath.Join(rulesDir, "go.mdc")); err == nil {
+		t.Error("Installed file of the removed rule was not deleted")
+	}
+	if _, err := os.Stat(filepath.Join(rulesDir, "other.mdc")); err != nil {
+		t.Errorf("Installed file of another rule was deleted: %v", err)
+	}
+
+	lock, err := lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if lock.Find("go") != nil || lock.Find("other") == nil {
+		t.Errorf("Lockfile does not match the remaining rules. Actual: %+v", lock.Rules)
+	}
+
+	// A file edited by hand is kept
+	if err := os.WriteFile(filepath.Join(rulesDir, "other.mdc"), []byte("Edited by hand"), 0644); err != nil {
+		t.Fatalf("Failed to edit installed rule: %v", err)
+	}
+	if err := RemoveRule(cfg, "other"); err != nil {
+		t.Fatalf("RemoveRule function returned an error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rulesDir, "other.mdc")); err != nil {
+		t.Errorf("Modified file was deleted: %v", err)
+	}
+}
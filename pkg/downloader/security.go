@@ -0,0 +1,95 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+// SecurityError is returned when a path computed for a rule would reach outside the rules directory.
+// Nothing is written for the rule.
+type SecurityError struct {
+	Rule   string
+	Path   string
+	Reason string
+}
+
+func (e *SecurityError) Error() string {
+	if e.Rule == "" {
+		return fmt.Sprintf("refusing to use '%s': %s", e.Path, e.Reason)
+	}
+	return fmt.Sprintf("refusing to write rule '%s' to '%s': %s", e.Rule, e.Path, e.Reason)
+}
+
+// rulePath returns the path of the file the rule is installed as, confined to the rules directory
+func rulePath(rulesDir string, rule config.Rule) (string, error) {
+	filePath, err := confinePath(rulesDir, ruleFileName(rule))
+	if err != nil {
+		var securityErr *SecurityError
+		if errors.As(err, &securityErr) {
+			securityErr.Rule = rule.Name
+		}
+		return "", err
+	}
+	return filePath, nil
+}
+
+// confinePath joins a file name to the rules directory.
+// The name must be a plain file name, and an existing file must not be a symbolic link,
+// so that neither the name nor a link placed in the directory can redirect a write.
+func confinePath(rulesDir string, name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`+"\x00") || !filepath.IsLocal(name) {
+		return "", &SecurityError{Path: name, Reason: "it is not a plain file name inside the rules directory"}
+	}
+
+	filePath := filepath.Join(rulesDir, name)
+	if filepath.Dir(filePath) != filepath.Clean(rulesDir) {
+		return "", &SecurityError{Path: filePath, Reason: "it is outside the rules directory"}
+	}
+
+	info, err := os.Lstat(filePath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return filePath, nil
+	case err != nil:
+		return "", fmt.Errorf("failed to inspect file '%s': %w", filePath, err)
+	case info.Mode()&fs.ModeSymlink != 0:
+		return "", &SecurityError{Path: filePath, Reason: "it is a symbolic link; remove it to let currm install the rule"}
+	case !info.Mode().IsRegular():
+		return "", &SecurityError{Path: filePath, Reason: "it is not a regular file"}
+	}
+	return filePath, nil
+}
+
+// projectRulesDir returns the rules directory of the current directory and creates it if needed.
+// Neither .cursor nor .cursor/rules may be a symbolic link, as a committed link could otherwise send
+// every rule somewhere else, such as .git/hooks. They are checked before anything is created through them.
+func projectRulesDir() (string, error) {
+	projectDir, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("failed to get current directory: %w", err)
+	}
+
+	for _, dir := range []string{".cursor", filepath.Join(".cursor", "rules")} {
+		dirPath := filepath.Join(projectDir, dir)
+		info, err := os.Lstat(dirPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// Created by GetRulesDir below
+		case err != nil:
+			return "", fmt.Errorf("failed to inspect directory '%s': %w", dirPath, err)
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, _ := os.Readlink(dirPath)
+			return "", &SecurityError{Path: dirPath, Reason: fmt.Sprintf("it is a symbolic link to '%s'", target)}
+		case !info.IsDir():
+			return "", &SecurityError{Path: dirPath, Reason: "it is not a directory"}
+		}
+	}
+
+	return config.GetRulesDir()
+}
@@ -0,0 +1,246 @@
+package downloader
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+// hostileNames are rule names from shared configurations that try to write outside the rules directory
+var hostileNames = []string{
+	"../../.git/hooks/pre-commit",
+	"../outside",
+	"../../../../../../tmp/evil",
+	"sub/../../escape",
+	"/etc/cron.d/evil",
+	`..\..\evil`,
+	`C:\Windows\evil`,
+	"nested/rule",
+	"rule\x00hidden",
+}
+
+func TestDownloadRuleHostileNames(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "hostile-names-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourcePath := filepath.Join(tempDir, "source.mdc")
+	if err := os.WriteFile(sourcePath, []byte("Hostile rule"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	rulesDir := filepath.Join(tempDir, "project", ".cursor", "rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+
+	for _, name := range hostileNames {
+		t.Run(name, func(t *testing.T) {
+			rule := config.Rule{Name: name, URL: "file://" + filepath.ToSlash(sourcePath)}
+			err := DownloadRule(rule, rulesDir)
+			var securityErr *SecurityError
+			if !errors.As(err, &securityErr) {
+				t.Fatalf("DownloadRule function did not return a SecurityError: %v", err)
+			}
+			if securityErr.Rule != name {
+				t.Errorf("Rule of the SecurityError does not match. Expected: %s, Actual: %s", name, securityErr.Rule)
+			}
+		})
+	}
+
+	// Nothing but the source and the empty rules directory exists
+	var written []string
+	filepath.Walk(tempDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && path != sourcePath {
+			written = append(written, path)
+		}
+		return nil
+	})
+	if len(written) != 0 {
+		t.Errorf("Files were written for hostile rule names: %v", written)
+	}
+
+	// A revision cannot add directories to the file name either, also when the source applies it
+	RegisterSchemeSource("memory", memorySource{rules: map[string]string{"go@../../feature/x": "Go rule at the revision"}})
+	rule := config.Rule{Name: "go", URL: "memory://go", Revision: "../../feature/x"}
+	if err := DownloadRule(rule, rulesDir); err != nil {
+		t.Fatalf("DownloadRule function returned an error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(rulesDir, "go-..-..-feature-x.mdc"))
+	if err != nil {
+		t.Fatalf("Rule with a revision containing slashes was not installed in the rules directory: %v", err)
+	}
+	if string(content) != "Go rule at the revision" {
+		t.Errorf("Rule was not fetched at the revision. Expected: %s, Actual: %s", "Go rule at the revision", string(content))
+	}
+}
+
+func TestDownloadRuleSymlink(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "symlink-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	sourcePath := filepath.Join(tempDir, "source.mdc")
+	if err := os.WriteFile(sourcePath, []byte("Rule content"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	rulesDir := filepath.Join(tempDir, "rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+
+	// A link placed where the rule is installed points at a file outside
+	victim := filepath.Join(tempDir, "victim")
+	if err := os.WriteFile(victim, []byte("original"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.Symlink(victim, filepath.Join(rulesDir, "go.mdc")); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+
+	rule := config.Rule{Name: "go", URL: "file://" + filepath.ToSlash(sourcePath)}
+	var securityErr *SecurityError
+	if err := DownloadRule(rule, rulesDir); !errors.As(err, &securityErr) {
+		t.Fatalf("DownloadRule function did not return a SecurityError: %v", err)
+	}
+	content, err := os.ReadFile(victim)
+	if err != nil || string(content) != "original" {
+		t.Errorf("File behind the link was changed: %s", string(content))
+	}
+}
+
+func TestDownloadAllRulesSymlinkedRulesDir(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "symlinked-rules-dir-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	// A committed .cursor/rules that links to the git hooks
+	hooksDir := filepath.Join(tempDir, ".git", "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Mkdir(".cursor", 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Symlink(filepath.Join("..", ".git", "hooks"), filepath.Join(".cursor", "rules")); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+	if err := os.WriteFile("pre-commit.mdc", []byte("#!/bin/sh"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "pre-commit", Path: "pre-commit.mdc"}},
+		Path:  filepath.Join(tempDir, "currm.yaml"),
+	}
+	var securityErr *SecurityError
+	if err := DownloadAllRules(cfg, Options{}); !errors.As(err, &securityErr) {
+		t.Fatalf("DownloadAllRules function did not return a SecurityError: %v", err)
+	}
+	if entries, _ := os.ReadDir(hooksDir); len(entries) != 0 {
+		t.Errorf("Files were written through the linked rules directory: %v", entries)
+	}
+}
+
+func TestDownloadAllRulesSymlinkedCursorDir(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "symlinked-cursor-dir-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	projectDir := filepath.Join(tempDir, "project")
+	outsideDir := filepath.Join(tempDir, "outside")
+	for _, dir := range []string{projectDir, outsideDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+
+	// Change to the project directory
+	if err := os.Chdir(projectDir); err != nil {
+		t.Fatalf("Failed to change to project directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	// A committed .cursor that links outside the project, without a rules directory yet
+	if err := os.Symlink(outsideDir, ".cursor"); err != nil {
+		t.Skipf("Symbolic links are not supported: %v", err)
+	}
+	if err := os.WriteFile("go.mdc", []byte("Go rule"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "go", Path: "go.mdc"}},
+		Path:  filepath.Join(projectDir, "currm.yaml"),
+	}
+	var securityErr *SecurityError
+	if err := DownloadAllRules(cfg, Options{}); !errors.As(err, &securityErr) {
+		t.Fatalf("DownloadAllRules function did not return a SecurityError: %v", err)
+	}
+	if entries, _ := os.ReadDir(outsideDir); len(entries) != 0 {
+		t.Errorf("Directories were created through the linked .cursor directory: %v", entries)
+	}
+}
+
+func TestRemoveInstalledHostileLockfile(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "hostile-lockfile-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	rulesDir := filepath.Join(tempDir, "rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+	victim := filepath.Join(tempDir, "victim")
+	if err := os.WriteFile(victim, []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	// An edited lockfile names a file outside the rules directory
+	file := lockfile.InstalledFile{File: "../victim", SHA256: sha256Hex([]byte("keep"))}
+	var securityErr *SecurityError
+	if _, err := removeInstalled(rulesDir, file, nil); !errors.As(err, &securityErr) {
+		t.Fatalf("removeInstalled function did not return a SecurityError: %v", err)
+	}
+	if _, err := os.Stat(victim); err != nil {
+		t.Errorf("File outside the rules directory was removed: %v", err)
+	}
+}
@@ -0,0 +1,144 @@
+package downloader
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/guchey/currm/pkg/cache"
+	"github.com/guchey/currm/pkg/config"
+)
+
+// Source fetches the content of rules from one kind of location.
+// Sources are registered with RegisterSchemeSource or RegisterHostSource and looked up for every rule.
+type Source interface {
+	// Resolve returns the location the rule is fetched from with its revision applied.
+	// The location identifies the content in the cache and is recorded in the lockfile.
+	Resolve(rule config.Rule) (string, error)
+	// Fetch fetches the content of the rule from the resolved location
+	Fetch(req *FetchRequest) (*FetchResult, error)
+}
+
+// TagLister is implemented by sources that can list the tags of the repository a rule comes from.
+// Rules whose revision is a version range such as "^1.2" can only be used with these sources.
+type TagLister interface {
+	// Tags returns the names of all tags of the repository of the rule
+	Tags(req *FetchRequest) ([]string, error)
+}
+
+// DirLister is implemented by sources that can list the files under a directory of a repository.
+// Rules with a dir source can only be used with these sources.
+type DirLister interface {
+	// ListDir returns a rule for every file under the directory of the rule.
+	// Each rule is named after the path of the file relative to the directory and has its url or git source set.
+	ListDir(req *FetchRequest) ([]config.Rule, error)
+}
+
+// FetchRequest describes what a source is asked to fetch
+type FetchRequest struct {
+	Rule config.Rule
+	// Location is the location returned by Resolve
+	Location string
+	// Revision is the exact revision to fetch, such as the commit recorded in the lockfile.
+	// When it is empty, sources that can resolve refs fetch what the configured ref points to now.
+	Revision string
+	// Client is the HTTP client configured with authentication, timeouts and retries
+	Client *http.Client
+	// Config is the configuration the rule belongs to
+	Config *config.Config
+	// ConfigDir is the directory of the configuration file
+	ConfigDir string
+	// CacheDir is a directory sources may keep data in; it is empty when there is no cache
+	CacheDir string
+	// Validators describe the content fetched last time; when set, the source may report that it is unchanged
+	Validators *cache.Validators
+
+	// commits is shared by the requests of a run; nil when the request is not made by a runner
+	commits *commitCache
+}
+
+// FetchResult is the content a source fetched and what it knows about it
+type FetchResult struct {
+	Content []byte
+	// NotModified reports that the content described by the validators is still current; Content is empty then
+	NotModified bool
+	// Revision is the exact revision the content was read from, such as a commit, if the source knows it
+	Revision string
+	// Path is the local file the content was read from, if any
+	Path string
+	// ETag and LastModified are the HTTP validators of the content, if any
+	ETag         string
+	LastModified string
+}
+
+var (
+	sourcesMu sync.RWMutex
+	// fieldSources fetch the rules that set a configuration field other than url
+	fieldSources = map[string]Source{}
+	// hostSources fetch URLs of a host; they take precedence over schemeSources
+	hostSources   = map[string]Source{}
+	schemeSources = map[string]Source{}
+)
+
+func init() {
+	RegisterSchemeSource("http", httpSource{})
+	RegisterSchemeSource("https", httpSource{})
+	RegisterSchemeSource("file", localSource{})
+	RegisterHostSource("github.com", githubSource{})
+	RegisterHostSource("raw.githubusercontent.com", githubSource{})
+	RegisterHostSource("gist.github.com", gistSource{})
+	RegisterHostSource("gist.githubusercontent.com", gistSource{})
+	RegisterHostSource("gitlab.com", gitlabSource{})
+	RegisterHostSource("bitbucket.org", bitbucketSource{})
+	RegisterHostSource("codeberg.org", giteaSource{})
+	fieldSources["path"] = localSource{}
+	fieldSources["git"] = newGitSource()
+}
+
+// RegisterSchemeSource makes source fetch the URLs with the scheme, such as "s3", replacing the source registered before.
+// The scheme is allowed in the url of rules from then on.
+func RegisterSchemeSource(scheme string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	schemeSources[strings.ToLower(scheme)] = source
+	config.AllowURLScheme(scheme)
+}
+
+// RegisterHostSource makes source fetch the URLs of the host, such as "github.com", replacing the source registered before.
+// It does not allow any new scheme.
+func RegisterHostSource(host string, source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	hostSources[strings.ToLower(host)] = source
+}
+
+// LookupSource returns the source that fetches the rule.
+// Configuration fields take precedence over the host of the URL, which takes precedence over its scheme.
+func LookupSource(rule config.Rule) (Source, error) {
+	sourcesMu.RLock()
+	defer sourcesMu.RUnlock()
+
+	switch {
+	case rule.Git != nil:
+		return fieldSources["git"], nil
+	case rule.Path != "":
+		return fieldSources["path"], nil
+	case rule.URL == "":
+		return nil, fmt.Errorf("rule '%s' has no url, path or git source", rule.Name)
+	}
+
+	u, err := url.Parse(rule.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL for rule '%s': %w", rule.Name, err)
+	}
+	if source, ok := hostSources[strings.ToLower(u.Hostname())]; ok && u.Hostname() != "" {
+		return source, nil
+	}
+	source, ok := schemeSources[strings.ToLower(u.Scheme)]
+	if !ok {
+		return nil, fmt.Errorf("no source is registered for '%s' used by rule '%s'", u.Scheme, rule.Name)
+	}
+	return source, nil
+}
@@ -0,0 +1,139 @@
+package downloader
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+// memorySource serves rules from a map keyed by the path of the URL, followed by "@revision" if the rule has one
+type memorySource struct {
+	rules map[string]string
+}
+
+func (m memorySource) Resolve(rule config.Rule) (string, error) {
+	if hasRevision(rule) {
+		return rule.URL + "@" + rule.Revision, nil
+	}
+	return rule.URL, nil
+}
+
+func (m memorySource) Fetch(req *FetchRequest) (*FetchResult, error) {
+	content, ok := m.rules[strings.TrimPrefix(req.Location, "memory://")]
+	if !ok {
+		return nil, fmt.Errorf("rule '%s' not found", req.Rule.Name)
+	}
+	return &FetchResult{Content: []byte(content), Revision: "0123456789abcdef0123456789abcdef01234567"}, nil
+}
+
+func TestLookupSource(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     config.Rule
+		expected Source
+		wantErr  bool
+	}{
+		{name: "https", rule: config.Rule{Name: "r", URL: "https://example.com/rule.mdc"}, expected: httpSource{}},
+		{name: "github", rule: config.Rule{Name: "r", URL: "https://github.com/owner/repo/blob/main/rule.mdc"}, expected: githubSource{}},
+		{name: "raw github", rule: config.Rule{Name: "r", URL: "https://raw.githubusercontent.com/owner/repo/main/rule.mdc"}, expected: githubSource{}},
+		{name: "file URL", rule: config.Rule{Name: "r", URL: "file:///rules/rule.mdc"}, expected: localSource{}},
+		{name: "path", rule: config.Rule{Name: "r", Path: "rules/rule.mdc"}, expected: localSource{}},
+		{name: "unknown scheme", rule: config.Rule{Name: "r", URL: "ftp://example.com/rule.mdc"}, wantErr: true},
+		{name: "no source", rule: config.Rule{Name: "r"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := LookupSource(tt.rule)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("No error was returned. Actual: %T", actual)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("LookupSource returned an error: %v", err)
+			}
+			if actual != tt.expected {
+				t.Errorf("Source does not match. Expected: %T, Actual: %T", tt.expected, actual)
+			}
+		})
+	}
+
+	// Git rules use the git source regardless of other fields
+	source, err := LookupSource(config.Rule{Name: "r", Git: &config.GitSource{Repo: "file:///repo.git", Path: "rule.mdc"}})
+	if err != nil {
+		t.Fatalf("LookupSource returned an error: %v", err)
+	}
+	if _, ok := source.(*gitSource); !ok {
+		t.Errorf("Source does not match. Expected: *gitSource, Actual: %T", source)
+	}
+}
+
+func TestRegisterSource(t *testing.T) {
+	RegisterSchemeSource("memory", memorySource{rules: map[string]string{"style": "memory rule"}})
+
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "source-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	cfg := &config.Config{
+		Rules: []config.Rule{{Name: "style", URL: "memory://style"}},
+		Path:  filepath.Join(tempDir, "currm.yaml"),
+	}
+
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(tempDir, ".cursor", "rules", "style.mdc"))
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(content) != "memory rule" {
+		t.Errorf("File content differs from expected. Expected: %s, Actual: %s", "memory rule", string(content))
+	}
+
+	// The revision reported by the source is recorded in the lockfile
+	lock, err := lockfile.Load(filepath.Join(tempDir, lockfile.FileName))
+	if err != nil {
+		t.Fatalf("Failed to load lockfile: %v", err)
+	}
+	if locked := lock.Find("style"); locked == nil || locked.ResolvedCommit != "0123456789abcdef0123456789abcdef01234567" {
+		t.Errorf("Revision of the source was not locked. Actual: %+v", locked)
+	}
+
+	// A host without a dot is not taken for a scheme
+	RegisterHostSource("intranet", memorySource{rules: map[string]string{"style": "memory rule"}})
+	if source, err := LookupSource(config.Rule{Name: "style", URL: "http://intranet/style"}); err != nil || source == nil {
+		t.Errorf("Source registered for the host was not found: %v", err)
+	}
+	configPath := filepath.Join(tempDir, "intranet.yaml")
+	if err := os.WriteFile(configPath, []byte("rules:\n  - name: style\n    url: intranet://style\n"), 0644); err != nil {
+		t.Fatalf("Failed to write configuration file: %v", err)
+	}
+	if _, err := config.LoadConfig(configPath); err == nil {
+		t.Error("Registering a host source allowed it as a URL scheme")
+	}
+}
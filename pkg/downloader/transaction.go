@@ -0,0 +1,301 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+	"gopkg.in/yaml.v3"
+)
+
+// backupDirName is the directory next to the rules directory that keeps the files replaced by the last install
+const backupDirName = ".currm-backup"
+
+// backupManifestName is the file in the backup directory that lists the backed up files
+const backupManifestName = "manifest.yaml"
+
+// backupManifest records what an install changed, so that rollback can undo it
+type backupManifest struct {
+	CreatedAt time.Time `yaml:"createdAt"`
+	// Lockfile is set if a lockfile existed before the install; its content is kept as currm.lock
+	Lockfile bool         `yaml:"lockfile"`
+	Files    []backupFile `yaml:"files"`
+}
+
+// backupFile is a file in the rules directory that an install wrote or removed
+type backupFile struct {
+	Name string `yaml:"name"`
+	// Existed is set if the file existed before the install; its content is kept in the files directory
+	Existed bool `yaml:"existed"`
+}
+
+// transaction stages the rules of an install and swaps them into the rules directory together.
+// The files it replaces are kept in a backup that rollback restores.
+type transaction struct {
+	rulesDir string
+	stageDir string
+	// backupDir collects the backup while the transaction commits; it replaces the previous backup in finish
+	backupDir string
+	// lockPath is set once the lockfile is backed up
+	lockPath string
+	manifest backupManifest
+}
+
+// beginTransaction creates the staging directory next to the rules directory, so that files can be renamed into it
+func beginTransaction(rulesDir string) (*transaction, error) {
+	stageDir, err := os.MkdirTemp(filepath.Dir(rulesDir), ".currm-staging-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return &transaction{rulesDir: rulesDir, stageDir: stageDir}, nil
+}
+
+// close removes the staging directory. A backup that was not finished belongs to an install that failed
+// after it began to swap files in; the files and the lockfile are restored from it before it is removed.
+// If that fails too, the backup is kept so that 'currm rollback' can undo the install.
+func (tx *transaction) close() {
+	os.RemoveAll(tx.stageDir)
+	if tx.backupDir == "" {
+		return
+	}
+
+	if err := tx.undo(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to undo the interrupted install: %v\n", err)
+		if err := tx.keep(); err != nil {
+			fmt.Fprintf(os.Stderr, "The replaced files are kept in '%s': %v\n", tx.backupDir, err)
+			return
+		}
+		fmt.Fprintln(os.Stderr, "Run 'currm rollback' to restore the rules installed before")
+		return
+	}
+	os.RemoveAll(tx.backupDir)
+}
+
+// undo restores what the transaction changed so far, in reverse order
+func (tx *transaction) undo() error {
+	for i := len(tx.manifest.Files) - 1; i >= 0; i-- {
+		if _, err := restoreFile(tx.rulesDir, tx.backupDir, tx.manifest.Files[i]); err != nil {
+			return err
+		}
+	}
+	if tx.lockPath == "" {
+		return nil
+	}
+	return restoreLockfile(tx.backupDir, tx.lockPath, tx.manifest.Lockfile)
+}
+
+// commit backs up the lockfile and the files the staged results replace, then renames the staged files into place
+func (tx *transaction) commit(lockPath string, results []*installResult) error {
+	backupDir, err := os.MkdirTemp(filepath.Dir(tx.rulesDir), ".currm-backup-*")
+	if err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tx.backupDir = backupDir
+	if err := os.Mkdir(filepath.Join(backupDir, "files"), 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	tx.manifest = backupManifest{CreatedAt: time.Now().UTC()}
+
+	if data, err := os.ReadFile(lockPath); err == nil {
+		if err := os.WriteFile(filepath.Join(backupDir, lockfile.FileName), data, 0644); err != nil {
+			return fmt.Errorf("failed to back up lockfile: %w", err)
+		}
+		tx.manifest.Lockfile = true
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to back up lockfile: %w", err)
+	}
+	tx.lockPath = lockPath
+
+	for _, result := range results {
+		if result.staged == "" {
+			continue
+		}
+
+		// A link may have been placed since the rule was staged
+		name := filepath.Base(result.Path)
+		if _, err := confinePath(tx.rulesDir, name); err != nil {
+			return err
+		}
+		existed, err := tx.backup(name)
+		if err != nil {
+			return err
+		}
+		if err := os.Rename(result.staged, result.Path); err != nil {
+			return fmt.Errorf("failed to install file '%s': %w", result.Path, err)
+		}
+		tx.manifest.Files = append(tx.manifest.Files, backupFile{Name: name, Existed: existed})
+	}
+	return nil
+}
+
+// backup copies the file in the rules directory into the backup and reports whether it existed
+func (tx *transaction) backup(name string) (bool, error) {
+	content, err := os.ReadFile(filepath.Join(tx.rulesDir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to back up file '%s': %w", name, err)
+	}
+	if err := os.WriteFile(filepath.Join(tx.backupDir, "files", name), content, 0644); err != nil {
+		return false, fmt.Errorf("failed to back up file '%s': %w", name, err)
+	}
+	return true, nil
+}
+
+// remove moves a file of the rules directory into the backup
+func (tx *transaction) remove(name string) error {
+	if err := os.Rename(filepath.Join(tx.rulesDir, name), filepath.Join(tx.backupDir, "files", name)); err != nil {
+		return fmt.Errorf("failed to remove file '%s': %w", filepath.Join(tx.rulesDir, name), err)
+	}
+	tx.manifest.Files = append(tx.manifest.Files, backupFile{Name: name, Existed: true})
+	return nil
+}
+
+// finish makes the backup of this install the one rollback restores.
+// An install that changed no file keeps the previous backup.
+func (tx *transaction) finish() error {
+	if len(tx.manifest.Files) == 0 {
+		os.RemoveAll(tx.backupDir)
+		tx.backupDir = ""
+		return nil
+	}
+	return tx.keep()
+}
+
+// keep writes the manifest and replaces the previous backup with the backup of this install
+func (tx *transaction) keep() error {
+	data, err := yaml.Marshal(tx.manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode backup manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(tx.backupDir, backupManifestName), data, 0644); err != nil {
+		return fmt.Errorf("failed to write backup manifest: %w", err)
+	}
+
+	backupPath := filepath.Join(filepath.Dir(tx.rulesDir), backupDirName)
+	if err := os.RemoveAll(backupPath); err != nil {
+		return fmt.Errorf("failed to remove previous backup: %w", err)
+	}
+	if err := os.Rename(tx.backupDir, backupPath); err != nil {
+		return fmt.Errorf("failed to keep backup: %w", err)
+	}
+	tx.backupDir = ""
+	return nil
+}
+
+// writeFileAtomic writes the file through a temporary file in the same directory,
+// so that readers see either the old or the new content
+func writeFileAtomic(filePath string, content []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create file '%s': %w", filePath, err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(content); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write to file '%s': %w", filePath, err)
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write to file '%s': %w", filePath, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write to file '%s': %w", filePath, err)
+	}
+
+	if err := os.Rename(file.Name(), filePath); err != nil {
+		return fmt.Errorf("failed to write to file '%s': %w", filePath, err)
+	}
+	return nil
+}
+
+// Rollback restores the rules directory and the lockfile to what they were before the last install
+// that changed them, and removes the backup.
+func Rollback(cfg *config.Config) error {
+	rulesDir, err := projectRulesDir()
+	if err != nil {
+		return err
+	}
+
+	backupPath := filepath.Join(filepath.Dir(rulesDir), backupDirName)
+	data, err := os.ReadFile(filepath.Join(backupPath, backupManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("there is no previous install to roll back to")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read backup manifest: %w", err)
+	}
+	var manifest backupManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("failed to parse backup manifest: %w", err)
+	}
+
+	fmt.Printf("Rolling back to the rules installed before %s\n", manifest.CreatedAt.Local().Format(time.DateTime))
+	for _, file := range manifest.Files {
+		filePath, err := restoreFile(rulesDir, backupPath, file)
+		if err != nil {
+			return err
+		}
+		if file.Existed {
+			fmt.Printf("Restored '%s'\n", filePath)
+		} else {
+			fmt.Printf("Removed '%s'\n", filePath)
+		}
+	}
+
+	if err := restoreLockfile(backupPath, lockfile.PathFor(cfg.Path), manifest.Lockfile); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(backupPath); err != nil {
+		return fmt.Errorf("failed to remove backup: %w", err)
+	}
+	return nil
+}
+
+// restoreFile puts a file of the rules directory back to its content in the backup,
+// or removes it if it did not exist before, and returns its path
+func restoreFile(rulesDir string, backupPath string, file backupFile) (string, error) {
+	filePath, err := confinePath(rulesDir, file.Name)
+	if err != nil {
+		return "", err
+	}
+	if !file.Existed {
+		if err := os.Remove(filePath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to remove file '%s': %w", filePath, err)
+		}
+		return filePath, nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(backupPath, "files", file.Name))
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup of '%s': %w", file.Name, err)
+	}
+	if err := writeFileAtomic(filePath, content); err != nil {
+		return "", err
+	}
+	return filePath, nil
+}
+
+// restoreLockfile puts the lockfile back to its content in the backup, or removes it if it did not exist before
+func restoreLockfile(backupPath string, lockPath string, existed bool) error {
+	if !existed {
+		if err := os.Remove(lockPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to remove lockfile: %w", err)
+		}
+		return nil
+	}
+
+	content, err := os.ReadFile(filepath.Join(backupPath, lockfile.FileName))
+	if err != nil {
+		return fmt.Errorf("failed to read backup of %s: %w", lockfile.FileName, err)
+	}
+	return writeFileAtomic(lockPath, content)
+}
@@ -0,0 +1,214 @@
+package downloader
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/guchey/currm/pkg/config"
+	"github.com/guchey/currm/pkg/lockfile"
+)
+
+func TestRollback(t *testing.T) {
+	// Save current working directory
+	originalDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get current directory: %v", err)
+	}
+
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "rollback-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	// Change to temporary directory
+	if err := os.Chdir(tempDir); err != nil {
+		t.Fatalf("Failed to change to temporary directory: %v", err)
+	}
+	// Return to original directory after test
+	defer os.Chdir(originalDir)
+
+	writeRule := func(name string, content string) {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write rule file: %v", err)
+		}
+	}
+	writeRule("go.mdc", "Go rule v1")
+	writeRule("shell.mdc", "Shell rule")
+	writeRule("python.mdc", "Python rule")
+
+	cfg := &config.Config{
+		Rules: []config.Rule{
+			{Name: "go", Path: "go.mdc"},
+			{Name: "shell", Path: "shell.mdc"},
+		},
+		Path: filepath.Join(tempDir, "currm.yaml"),
+	}
+	if err := DownloadAllRules(cfg, Options{}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+	lockPath := filepath.Join(tempDir, lockfile.FileName)
+	firstLock, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatalf("Failed to read lockfile: %v", err)
+	}
+
+	// The second install changes go, adds python and prunes shell
+	writeRule("go.mdc", "Go rule v2")
+	cfg.Rules = []config.Rule{
+		{Name: "go", Path: "go.mdc"},
+		{Name: "python", Path: "python.mdc"},
+	}
+	if err := DownloadAllRules(cfg, Options{Prune: true}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	readInstalled := func(name string) string {
+		content, err := os.ReadFile(filepath.Join(rulesDir, name))
+		if err != nil {
+			return ""
+		}
+		return string(content)
+	}
+	if readInstalled("go.mdc") != "Go rule v2" || readInstalled("python.mdc") != "Python rule" || readInstalled("shell.mdc") != "" {
+		t.Fatalf("Second install did not change the rules as expected")
+	}
+
+	// Staging directories do not stay behind
+	if matches, _ := filepath.Glob(filepath.Join(tempDir, ".cursor", ".currm-staging-*")); len(matches) != 0 {
+		t.Errorf("Staging directories were not removed: %v", matches)
+	}
+
+	// An install that changes nothing keeps the backup of the second install
+	if err := DownloadAllRules(cfg, Options{Prune: true}); err != nil {
+		t.Fatalf("DownloadAllRules function returned an error: %v", err)
+	}
+
+	if err := Rollback(cfg); err != nil {
+		t.Fatalf("Rollback function returned an error: %v", err)
+	}
+
+	expected := map[string]string{
+		"go.mdc":     "Go rule v1",
+		"shell.mdc":  "Shell rule",
+		"python.mdc": "",
+	}
+	for name, content := range expected {
+		if actual := readInstalled(name); actual != content {
+			t.Errorf("Content of %s differs from expected after rollback. Expected: %q, Actual: %q", name, content, actual)
+		}
+	}
+	lock, err := os.ReadFile(lockPath)
+	if err != nil {
+		t.Fatalf("Failed to read lockfile: %v", err)
+	}
+	if string(lock) != string(firstLock) {
+		t.Errorf("Lockfile was not restored. Expected: %s, Actual: %s", string(firstLock), string(lock))
+	}
+
+	// The backup is used up by the rollback
+	if err := Rollback(cfg); err == nil {
+		t.Error("No error was returned for a rollback without a backup")
+	}
+}
+
+func TestTransactionCommitFailure(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "commit-failure-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	rulesDir := filepath.Join(tempDir, ".cursor", "rules")
+	if err := os.MkdirAll(filepath.Join(rulesDir, "broken.mdc"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(rulesDir, "go.mdc"), []byte("Go rule v1"), 0644); err != nil {
+		t.Fatalf("Failed to write rule file: %v", err)
+	}
+	lockPath := filepath.Join(tempDir, lockfile.FileName)
+	if err := os.WriteFile(lockPath, []byte("v1"), 0644); err != nil {
+		t.Fatalf("Failed to write lockfile: %v", err)
+	}
+	previousManifest := filepath.Join(tempDir, ".cursor", backupDirName, backupManifestName)
+	if err := os.MkdirAll(filepath.Dir(previousManifest), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(previousManifest, []byte("files: []"), 0644); err != nil {
+		t.Fatalf("Failed to write manifest: %v", err)
+	}
+
+	tx, err := beginTransaction(rulesDir)
+	if err != nil {
+		t.Fatalf("beginTransaction function returned an error: %v", err)
+	}
+	var results []*installResult
+	for _, name := range []string{"go.mdc", "new.mdc", "broken.mdc"} {
+		staged := filepath.Join(tx.stageDir, name)
+		if err := os.WriteFile(staged, []byte("v2"), 0644); err != nil {
+			t.Fatalf("Failed to write staged file: %v", err)
+		}
+		results = append(results, &installResult{Path: filepath.Join(rulesDir, name), staged: staged})
+	}
+
+	// The last file cannot replace a directory, after the others were swapped in
+	if err := tx.commit(lockPath, results); err == nil {
+		t.Fatal("commit function did not return an error")
+	}
+	tx.close()
+
+	if content, err := os.ReadFile(filepath.Join(rulesDir, "go.mdc")); err != nil || string(content) != "Go rule v1" {
+		t.Errorf("Replaced file was not restored. Expected: %s, Actual: %s", "Go rule v1", string(content))
+	}
+	if _, err := os.Stat(filepath.Join(rulesDir, "new.mdc")); err == nil {
+		t.Error("Added file was not removed")
+	}
+	if content, err := os.ReadFile(lockPath); err != nil || string(content) != "v1" {
+		t.Errorf("Lockfile was changed. Expected: %s, Actual: %s", "v1", string(content))
+	}
+	if _, err := os.Stat(previousManifest); err != nil {
+		t.Errorf("Previous backup was not kept: %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(tempDir, ".cursor", ".currm-*-*")); len(matches) != 0 {
+		t.Errorf("Temporary directories were not removed: %v", matches)
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	// Create temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "atomic-write-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	filePath := filepath.Join(tempDir, "rule.mdc")
+	for _, content := range []string{"first", "second"} {
+		if err := writeFileAtomic(filePath, []byte(content)); err != nil {
+			t.Fatalf("writeFileAtomic function returned an error: %v", err)
+		}
+		actual, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to read file: %v", err)
+		}
+		if string(actual) != content {
+			t.Errorf("File content differs from expected. Expected: %s, Actual: %s", content, string(actual))
+		}
+	}
+
+	// Only the file itself is left in the directory
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Temporary files were left behind: %v", entries)
+	}
+	if info, err := os.Stat(filePath); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("File does not have the expected permissions: %v", info.Mode())
+	}
+}
@@ -0,0 +1,239 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+// Default values used when neither the configuration nor a flag sets them
+const (
+	DefaultTimeout        = 2 * time.Minute
+	DefaultRequestTimeout = 30 * time.Second
+	DefaultRetries        = 3
+	DefaultInitialBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff     = 10 * time.Second
+)
+
+// Settings configures the HTTP client used to fetch rules
+type Settings struct {
+	// Timeout is the total time allowed for a request, including retries and reading the body
+	Timeout time.Duration
+	// RequestTimeout is the time allowed for a single attempt
+	RequestTimeout time.Duration
+	// Retries is the number of times a failed attempt is retried
+	Retries int
+	// InitialBackoff is the upper bound of the delay before the first retry; it doubles on every retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the delay between two attempts
+	MaxBackoff time.Duration
+	// Transport performs the actual requests; http.DefaultTransport is used when it is nil
+	Transport http.RoundTripper
+}
+
+// DefaultSettings returns the settings used when nothing is configured
+func DefaultSettings() Settings {
+	return Settings{
+		Timeout:        DefaultTimeout,
+		RequestTimeout: DefaultRequestTimeout,
+		Retries:        DefaultRetries,
+		InitialBackoff: DefaultInitialBackoff,
+		MaxBackoff:     DefaultMaxBackoff,
+	}
+}
+
+// FromConfig returns the default settings overridden by the values set in the configuration
+func FromConfig(cfg config.HTTPConfig) Settings {
+	settings := DefaultSettings()
+	if cfg.Timeout > 0 {
+		settings.Timeout = cfg.Timeout
+	}
+	if cfg.RequestTimeout > 0 {
+		settings.RequestTimeout = cfg.RequestTimeout
+	}
+	if cfg.Retries != nil {
+		settings.Retries = *cfg.Retries
+	}
+	if cfg.InitialBackoff > 0 {
+		settings.InitialBackoff = cfg.InitialBackoff
+	}
+	if cfg.MaxBackoff > 0 {
+		settings.MaxBackoff = cfg.MaxBackoff
+	}
+	return settings
+}
+
+// New creates an HTTP client that applies the timeouts and retries of the settings
+func New(settings Settings) *http.Client {
+	base := settings.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Timeout: settings.Timeout,
+		Transport: &retryTransport{
+			base:     base,
+			settings: settings,
+		},
+	}
+}
+
+// retryTransport retries failed attempts with jittered exponential backoff
+type retryTransport struct {
+	base     http.RoundTripper
+	settings Settings
+}
+
+// RoundTrip implements http.RoundTripper
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Requests whose body cannot be replayed are sent only once
+	retries := t.settings.Retries
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		retries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, cancel := t.prepareAttempt(req, attempt)
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= retries || req.Context().Err() != nil || !shouldRetry(resp, err) {
+			if err != nil {
+				cancel()
+				return nil, err
+			}
+			// Keep the attempt context alive until the caller has read the body
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		}
+
+		delay := backoff(t.settings, attempt)
+		if resp != nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				delay = retryAfter
+			}
+			// Drain the body so that the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		cancel()
+
+		if err := sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// prepareAttempt returns the request for a single attempt and a function releasing its resources
+func (t *retryTransport) prepareAttempt(req *http.Request, attempt int) (*http.Request, context.CancelFunc) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.settings.RequestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.settings.RequestTimeout)
+	}
+
+	attemptReq := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		if body, err := req.GetBody(); err == nil {
+			attemptReq.Body = body
+		}
+	}
+	return attemptReq, cancel
+}
+
+// shouldRetry reports whether the outcome of an attempt is worth retrying
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return isTransientError(err)
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return true
+	case resp.StatusCode == http.StatusNotImplemented:
+		return false
+	default:
+		return resp.StatusCode >= 500
+	}
+}
+
+// isTransientError reports whether a transport error is likely to go away on its own
+func isTransientError(err error) bool {
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return true
+	}
+
+	// The attempt timed out; the total timeout is checked separately by the caller
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// backoff returns a random delay of up to InitialBackoff * 2^attempt, capped at MaxBackoff
+func backoff(settings Settings, attempt int) time.Duration {
+	limit := settings.InitialBackoff
+	for i := 0; i < attempt && limit < settings.MaxBackoff; i++ {
+		limit *= 2
+	}
+	if settings.MaxBackoff > 0 && limit > settings.MaxBackoff {
+		limit = settings.MaxBackoff
+	}
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(limit)) + 1)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
+
+// sleep waits for the delay or until the context is done
+func sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// cancelOnClose releases the context of an attempt once the response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,231 @@
+package httpclient
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/guchey/currm/pkg/config"
+)
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fastSettings returns settings with short delays suitable for tests
+func fastSettings() Settings {
+	return Settings{
+		Timeout:        5 * time.Second,
+		RequestTimeout: time.Second,
+		Retries:        3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+	}
+}
+
+func TestRetryOnServerErrors(t *testing.T) {
+	testCases := []struct {
+		name             string
+		statuses         []int
+		expectedStatus   int
+		expectedAttempts int32
+	}{
+		{"Recovers from 502", []int{http.StatusBadGateway, http.StatusOK}, http.StatusOK, 2},
+		{"Recovers from 429", []int{http.StatusTooManyRequests, http.StatusServiceUnavailable, http.StatusOK}, http.StatusOK, 3},
+		{"Gives up after retries", []int{500, 500, 500, 500, 500}, http.StatusInternalServerError, 4},
+		{"Does not retry 404", []int{http.StatusNotFound, http.StatusOK}, http.StatusNotFound, 1},
+		{"Does not retry 501", []int{http.StatusNotImplemented, http.StatusOK}, http.StatusNotImplemented, 1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := atomic.AddInt32(&attempts, 1)
+				w.WriteHeader(tc.statuses[attempt-1])
+				fmt.Fprintf(w, "attempt %d", attempt)
+			}))
+			defer server.Close()
+
+			resp, err := New(fastSettings()).Get(server.URL)
+			if err != nil {
+				t.Fatalf("Request returned an error: %v", err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+
+			if resp.StatusCode != tc.expectedStatus {
+				t.Errorf("Status code differs from expected. Expected: %d, Actual: %d", tc.expectedStatus, resp.StatusCode)
+			}
+			if attempts != tc.expectedAttempts {
+				t.Errorf("Number of attempts differs from expected. Expected: %d, Actual: %d", tc.expectedAttempts, attempts)
+			}
+			if expected := fmt.Sprintf("attempt %d", tc.expectedAttempts); string(body) != expected {
+				t.Errorf("Body differs from expected. Expected: %s, Actual: %s", expected, string(body))
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var attempts int32
+	var firstAttempt time.Time
+	var delay time.Duration
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			firstAttempt = time.Now()
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		delay = time.Since(firstAttempt)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := New(fastSettings()).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("Status code differs from expected. Expected: %d, Actual: %d", http.StatusOK, resp.StatusCode)
+	}
+	if delay < time.Second {
+		t.Errorf("Retry-After was not respected. Expected a delay of at least 1s, Actual: %s", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if delay, ok := parseRetryAfter("3"); !ok || delay != 3*time.Second {
+		t.Errorf("Failed to parse seconds. Actual: %s, %t", delay, ok)
+	}
+
+	date := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	if delay, ok := parseRetryAfter(date); !ok || delay <= 59*time.Minute {
+		t.Errorf("Failed to parse HTTP date. Actual: %s, %t", delay, ok)
+	}
+
+	for _, invalid := range []string{"", "soon", "-1"} {
+		if _, ok := parseRetryAfter(invalid); ok {
+			t.Errorf("Invalid value '%s' was accepted", invalid)
+		}
+	}
+}
+
+func TestRetryWithCustomTransport(t *testing.T) {
+	var attempts int32
+	settings := fastSettings()
+	settings.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return nil, syscall.ECONNRESET
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("recovered")),
+			Header:     make(http.Header),
+			Request:    req,
+		}, nil
+	})
+
+	resp, err := New(settings).Get("https://rules.example.com/rule.mdc")
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if string(body) != "recovered" || attempts != 2 {
+		t.Errorf("Connection reset was not retried. Body: %s, Attempts: %d", string(body), attempts)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	var attempts int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The first attempt hangs until the client gives up on it
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	settings := fastSettings()
+	settings.RequestTimeout = 100 * time.Millisecond
+
+	resp, err := New(settings).Get(server.URL)
+	if err != nil {
+		t.Fatalf("Request returned an error: %v", err)
+	}
+	resp.Body.Close()
+
+	if attempts != 2 {
+		t.Errorf("Timed out attempt was not retried. Attempts: %d", attempts)
+	}
+
+	// The total timeout stops retrying
+	hangingServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer hangingServer.Close()
+
+	settings.Timeout = 250 * time.Millisecond
+	settings.Retries = 100
+
+	start := time.Now()
+	if _, err := New(settings).Get(hangingServer.URL); err == nil {
+		t.Error("No error was returned when the total timeout expired")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Total timeout was not respected. Elapsed: %s", elapsed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	settings := Settings{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	for attempt := 0; attempt < 10; attempt++ {
+		limit := settings.InitialBackoff << attempt
+		if limit > settings.MaxBackoff {
+			limit = settings.MaxBackoff
+		}
+		for i := 0; i < 20; i++ {
+			if delay := backoff(settings, attempt); delay <= 0 || delay > limit {
+				t.Fatalf("Delay for attempt %d out of range. Limit: %s, Actual: %s", attempt, limit, delay)
+			}
+		}
+	}
+}
+
+func TestFromConfig(t *testing.T) {
+	settings := FromConfig(config.HTTPConfig{})
+	if settings != DefaultSettings() {
+		t.Errorf("Empty configuration does not produce the default settings: %+v", settings)
+	}
+
+	retries := 0
+	settings = FromConfig(config.HTTPConfig{
+		Timeout:        time.Minute,
+		RequestTimeout: 5 * time.Second,
+		Retries:        &retries,
+	})
+	if settings.Timeout != time.Minute || settings.RequestTimeout != 5*time.Second || settings.Retries != 0 {
+		t.Errorf("Configured values were not applied: %+v", settings)
+	}
+	if settings.InitialBackoff != DefaultInitialBackoff || settings.MaxBackoff != DefaultMaxBackoff {
+		t.Errorf("Unset values do not fall back to the defaults: %+v", settings)
+	}
+}
@@ -0,0 +1,102 @@
+package lockfile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/guchey/currm/pkg/config"
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the name of the lockfile written next to the configuration file
+const FileName = "currm.lock"
+
+// currentVersion is the format version of the lockfile
+const currentVersion = 1
+
+// LockedRule records how a rule was resolved and what was installed for it
+type LockedRule struct {
+	Name             string            `yaml:"name"`
+	URL              string            `yaml:"url,omitempty"`              // URL as written in the configuration file
+	Path             string            `yaml:"path,omitempty"`             // Local path as written in the configuration file
+	Git              *config.GitSource `yaml:"git,omitempty"`              // Git source as written in the configuration file
+	Revision         string            `yaml:"revision,omitempty"`         // Revision as written in the configuration file
+	From             string            `yaml:"from,omitempty"`             // Dir rule the rule was imported from
+	File             string            `yaml:"file,omitempty"`             // Name of the file installed in the rules directory
+	ResolvedURL      string            `yaml:"resolvedUrl"`                // URL the content was actually fetched from
+	ResolvedRevision string            `yaml:"resolvedRevision,omitempty"` // Tag a version range revision resolved to
+	ResolvedCommit   string            `yaml:"resolvedCommit,omitempty"`
+	SHA256           string            `yaml:"sha256"` // SHA-256 of the bytes written to the rules directory
+	FetchedAt        time.Time         `yaml:"fetchedAt"`
+}
+
+// InstalledFile is a file currm installed in the rules directory
+type InstalledFile struct {
+	File   string `yaml:"file"`
+	SHA256 string `yaml:"sha256"` // SHA-256 of the bytes that were written
+}
+
+// Lockfile represents the structure of the lockfile
+type Lockfile struct {
+	Version int          `yaml:"version"`
+	Rules   []LockedRule `yaml:"rules"`
+	// Orphaned lists installed files that no rule produces anymore, such as the files of removed rules.
+	// They are kept until 'currm pull --prune' deletes them.
+	Orphaned []InstalledFile `yaml:"orphaned,omitempty"`
+}
+
+// PathFor returns the path of the lockfile that belongs to the given configuration file
+func PathFor(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), FileName)
+}
+
+// New returns an empty lockfile
+func New() *Lockfile {
+	return &Lockfile{Version: currentVersion}
+}
+
+// Load loads the lockfile from the specified path
+func Load(path string) (*Lockfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lockfile: %w", err)
+	}
+
+	var lock Lockfile
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("failed to parse lockfile: %w", err)
+	}
+
+	if lock.Version > currentVersion {
+		return nil, fmt.Errorf("unsupported lockfile version %d", lock.Version)
+	}
+
+	return &lock, nil
+}
+
+// Save writes the lockfile to the specified path
+func (l *Lockfile) Save(path string) error {
+	data, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("failed to encode lockfile: %w", err)
+	}
+
+	header := []byte("# This file is generated by currm. Do not edit it by hand.\n")
+	if err := os.WriteFile(path, append(header, data...), 0644); err != nil {
+		return fmt.Errorf("failed to write lockfile: %w", err)
+	}
+
+	return nil
+}
+
+// Find returns the locked entry for the named rule, or nil if there is none
+func (l *Lockfile) Find(name string) *LockedRule {
+	for i := range l.Rules {
+		if l.Rules[i].Name == name {
+			return &l.Rules[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPathFor(t *testing.T) {
+	testCases := []struct {
+		configPath string
+		expected   string
+	}{
+		{"currm.yaml", "currm.lock"},
+		{"", "currm.lock"},
+		{filepath.Join("configs", "team.yaml"), filepath.Join("configs", "currm.lock")},
+	}
+
+	for _, tc := range testCases {
+		if actual := PathFor(tc.configPath); actual != tc.expected {
+			t.Errorf("Lockfile path for '%s' does not match. Expected: %s, Actual: %s", tc.configPath, tc.expected, actual)
+		}
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	// Create a temporary directory for testing
+	tempDir, err := os.MkdirTemp("", "lockfile-test-*")
+	if err != nil {
+		t.Fatalf("Failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	fetchedAt := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	lock := New()
+	lock.Rules = append(lock.Rules, LockedRule{
+		Name:           "go",
+		URL:            "https://raw.githubusercontent.com/owner/repo/main/go.mdc",
+		Revision:       "0123456789abcdef0123456789abcdef01234567",
+		ResolvedURL:    "https://raw.githubusercontent.com/owner/repo/0123456789abcdef0123456789abcdef01234567/go.mdc",
+		ResolvedCommit: "0123456789abcdef0123456789abcdef01234567",
+		SHA256:         "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855",
+		FetchedAt:      fetchedAt,
+	})
+
+	lockPath := filepath.Join(tempDir, FileName)
+	if err := lock.Save(lockPath); err != nil {
+		t.Fatalf("Save returned an error: %v", err)
+	}
+
+	loaded, err := Load(lockPath)
+	if err != nil {
+		t.Fatalf("Load returned an error: %v", err)
+	}
+
+	if loaded.Version != currentVersion {
+		t.Errorf("Lockfile version does not match. Expected: %d, Actual: %d", currentVersion, loaded.Version)
+	}
+
+	locked := loaded.Find("go")
+	if locked == nil {
+		t.Fatal("Locked rule 'go' was not found")
+	}
+	if *locked != lock.Rules[0] {
+		t.Errorf("Locked rule differs after round trip.\nExpected: %+v\nActual: %+v", lock.Rules[0], *locked)
+	}
+
+	if loaded.Find("missing") != nil {
+		t.Error("Find returned an entry for a rule that is not locked")
+	}
+
+	// Test with a lockfile written by a newer version
+	if err := os.WriteFile(lockPath, []byte("version: 99\nrules: []\n"), 0644); err != nil {
+		t.Fatalf("Failed to write lockfile: %v", err)
+	}
+	if _, err := Load(lockPath); err == nil {
+		t.Error("No error occurred for an unsupported lockfile version")
+	}
+}
@@ -0,0 +1,248 @@
+package semver
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// comparator is a single condition such as >=1.2.0
+type comparator struct {
+	op      string
+	version Version
+}
+
+// matches reports whether v satisfies the comparator
+func (c comparator) matches(v *Version) bool {
+	cmp := v.Compare(&c.version)
+	switch c.op {
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	default:
+		return cmp == 0
+	}
+}
+
+// Constraint is a range of versions such as "^1.2", "~1.4.0" or ">=1.0 <3 || 4.x"
+type Constraint struct {
+	// alternatives are joined by "||"; the comparators of an alternative must all match
+	alternatives [][]comparator
+	original     string
+}
+
+// IsConstraint reports whether a revision is a version range rather than a branch, tag or commit
+func IsConstraint(revision string) bool {
+	s := strings.TrimSpace(revision)
+	if s == "" {
+		return false
+	}
+	if strings.ContainsAny(s[:1], "^~<>=") || strings.Contains(s, "||") || s == "*" {
+		return true
+	}
+	return strings.HasSuffix(s, ".x") || strings.HasSuffix(s, ".X") || strings.HasSuffix(s, ".*")
+}
+
+// ParseConstraint parses a version range.
+// It understands ^ and ~ ranges, comparisons with >, >=, <, <= and =, x wildcards, and alternatives joined by "||".
+func ParseConstraint(s string) (*Constraint, error) {
+	constraint := &Constraint{original: s}
+	for _, alternative := range strings.Split(s, "||") {
+		var comparators []comparator
+		operator := ""
+		for _, term := range strings.FieldsFunc(alternative, func(r rune) bool { return r == ' ' || r == ',' }) {
+			// An operator may be separated from its version, as in ">= 1.2"
+			if strings.Trim(term, "^~<>=") == "" {
+				operator += term
+				continue
+			}
+			parsed, err := parseTerm(operator + term)
+			operator = ""
+			if err != nil {
+				return nil, fmt.Errorf("invalid version range '%s': %w", s, err)
+			}
+			comparators = append(comparators, parsed...)
+		}
+		if operator != "" {
+			return nil, fmt.Errorf("invalid version range '%s': '%s' is missing a version", s, operator)
+		}
+		constraint.alternatives = append(constraint.alternatives, comparators)
+	}
+	return constraint, nil
+}
+
+// String returns the range as it was written
+func (c *Constraint) String() string {
+	return c.original
+}
+
+// Check reports whether v is in the range.
+// Pre-releases only match when an alternative names a pre-release of the same version.
+func (c *Constraint) Check(v *Version) bool {
+	for _, comparators := range c.alternatives {
+		matches := true
+		allowPrerelease := v.Prerelease == ""
+		for _, comp := range comparators {
+			if !comp.matches(v) {
+				matches = false
+				break
+			}
+			if comp.version.Prerelease != "" && comp.version.Major == v.Major && comp.version.Minor == v.Minor && comp.version.Patch == v.Patch {
+				allowPrerelease = true
+			}
+		}
+		if matches && allowPrerelease {
+			return true
+		}
+	}
+	return false
+}
+
+// Highest returns the highest of the tags that are versions in the range, or nil if none is
+func (c *Constraint) Highest(tags []string) *Version {
+	var highest *Version
+	for _, v := range Versions(tags) {
+		if c.Check(v) {
+			highest = v
+		}
+	}
+	return highest
+}
+
+// Versions returns the tags that are versions, sorted from lowest to highest; other tags are skipped
+func Versions(tags []string) []*Version {
+	var versions []*Version
+	for _, tag := range tags {
+		if v, err := Parse(tag); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Compare(versions[j]) < 0
+	})
+	return versions
+}
+
+// Latest returns the highest release (not pre-release) version among the tags, or nil if there is none
+func Latest(tags []string) *Version {
+	var latest *Version
+	for _, v := range Versions(tags) {
+		if v.Prerelease == "" {
+			latest = v
+		}
+	}
+	return latest
+}
+
+// parseTerm expands a single term of a range into comparators
+func parseTerm(term string) ([]comparator, error) {
+	op := ""
+	for _, prefix := range []string{">=", "<=", ">", "<", "=", "^", "~"} {
+		if strings.HasPrefix(term, prefix) {
+			op = prefix
+			term = strings.TrimSpace(strings.TrimPrefix(term, prefix))
+			break
+		}
+	}
+
+	v, parts, err := parsePartial(term)
+	if err != nil {
+		return nil, err
+	}
+
+	// Wildcards match everything
+	if parts == 0 {
+		if op == "<" || op == ">" {
+			return nil, fmt.Errorf("'%s%s' matches no version", op, term)
+		}
+		return nil, nil
+	}
+
+	lower := comparator{op: ">=", version: v}
+	switch op {
+	case "^":
+		// Allow changes that do not modify the left-most non-zero number
+		switch {
+		case v.Major > 0 || parts == 1:
+			return []comparator{lower, {op: "<", version: Version{Major: v.Major + 1}}}, nil
+		case v.Minor > 0 || parts == 2:
+			return []comparator{lower, {op: "<", version: Version{Minor: v.Minor + 1}}}, nil
+		default:
+			return []comparator{lower, {op: "<", version: Version{Patch: v.Patch + 1}}}, nil
+		}
+	case "~":
+		// Allow patch changes, or minor changes if only the major version is given
+		if parts == 1 {
+			return []comparator{lower, {op: "<", version: Version{Major: v.Major + 1}}}, nil
+		}
+		return []comparator{lower, {op: "<", version: Version{Major: v.Major, Minor: v.Minor + 1}}}, nil
+	case ">=":
+		return []comparator{lower}, nil
+	case ">":
+		if parts < 3 {
+			return []comparator{{op: ">=", version: nextPartial(v, parts)}}, nil
+		}
+		return []comparator{{op: ">", version: v}}, nil
+	case "<":
+		return []comparator{{op: "<", version: v}}, nil
+	case "<=":
+		if parts < 3 {
+			return []comparator{{op: "<", version: nextPartial(v, parts)}}, nil
+		}
+		return []comparator{{op: "<=", version: v}}, nil
+	}
+
+	// A plain version matches exactly, a partial one every version it is a prefix of
+	if parts < 3 {
+		return []comparator{lower, {op: "<", version: nextPartial(v, parts)}}, nil
+	}
+	return []comparator{{op: "=", version: v}}, nil
+}
+
+// nextPartial returns the lowest version that is not covered by a partial version with the given number of parts
+func nextPartial(v Version, parts int) Version {
+	if parts == 1 {
+		return Version{Major: v.Major + 1}
+	}
+	return Version{Major: v.Major, Minor: v.Minor + 1}
+}
+
+// parsePartial parses a version in which trailing numbers may be missing or wildcards.
+// It returns how many numbers were given.
+func parsePartial(s string) (Version, int, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "v"), "V")
+	s, _, _ = strings.Cut(s, "+")
+	s, prerelease, _ := strings.Cut(s, "-")
+
+	var v Version
+	numbers := []*int{&v.Major, &v.Minor, &v.Patch}
+	parts := 0
+	for i, part := range strings.Split(s, ".") {
+		if i >= len(numbers) {
+			return Version{}, 0, fmt.Errorf("invalid version '%s'", s)
+		}
+		if part == "x" || part == "X" || part == "*" || part == "" {
+			break
+		}
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, 0, fmt.Errorf("invalid version '%s'", s)
+		}
+		*numbers[i] = n
+		parts++
+	}
+
+	if prerelease != "" {
+		if parts < 3 {
+			return Version{}, 0, fmt.Errorf("invalid version '%s': pre-releases need a full version", s)
+		}
+		v.Prerelease = prerelease
+	}
+	return v, parts, nil
+}
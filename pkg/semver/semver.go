@@ -0,0 +1,110 @@
+package semver
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version such as 1.2.3 or v1.2.3-rc.1
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+	// Original is the text the version was parsed from, such as a tag name
+	Original string
+}
+
+// Parse parses a version with an optional "v" prefix.
+// Missing minor and patch numbers are treated as zero, so "v1.2" is 1.2.0.
+func Parse(s string) (*Version, error) {
+	text := strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "v"), "V")
+
+	// Build metadata does not take part in comparisons
+	text, _, _ = strings.Cut(text, "+")
+	text, prerelease, _ := strings.Cut(text, "-")
+
+	parts := strings.Split(text, ".")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid version '%s'", s)
+	}
+
+	numbers := [3]int{}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 || (len(part) > 1 && part[0] == '0') {
+			return nil, fmt.Errorf("invalid version '%s'", s)
+		}
+		numbers[i] = n
+	}
+
+	return &Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease, Original: s}, nil
+}
+
+// String returns the version without prefix
+func (v *Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 when v is lower than, equal to or higher than other
+func (v *Version) Compare(other *Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	return comparePrerelease(v.Prerelease, other.Prerelease)
+}
+
+// comparePrerelease compares pre-release identifiers; a version without one is higher than any with one
+func comparePrerelease(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		aNum, aErr := strconv.Atoi(aParts[i])
+		bNum, bErr := strconv.Atoi(bParts[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if aNum != bNum {
+				if aNum < bNum {
+					return -1
+				}
+				return 1
+			}
+		case aErr == nil:
+			// Numeric identifiers are lower than alphanumeric ones
+			return -1
+		case bErr == nil:
+			return 1
+		case aParts[i] != bParts[i]:
+			if aParts[i] < bParts[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	}
+	return 0
+}
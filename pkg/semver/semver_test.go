@@ -0,0 +1,147 @@
+package semver
+
+import (
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{input: "1.2.3", expected: "1.2.3"},
+		{input: "v1.2.3", expected: "1.2.3"},
+		{input: "v1.2", expected: "1.2.0"},
+		{input: "2", expected: "2.0.0"},
+		{input: "v1.0.0-rc.1+build.5", expected: "1.0.0-rc.1"},
+		{input: "main", wantErr: true},
+		{input: "1.02.0", wantErr: true},
+		{input: "1.2.3.4", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			v, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error for '%s', got %s", tt.input, v)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Failed to parse '%s': %v", tt.input, err)
+			}
+			if v.String() != tt.expected {
+				t.Errorf("Version does not match. Expected: %s, Actual: %s", tt.expected, v.String())
+			}
+			if v.Original != tt.input {
+				t.Errorf("Original does not match. Expected: %s, Actual: %s", tt.input, v.Original)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []string{"1.0.0-alpha", "1.0.0-alpha.1", "1.0.0-alpha.beta", "1.0.0-beta", "1.0.0-beta.2", "1.0.0-beta.11", "1.0.0-rc.1", "1.0.0", "1.0.1", "1.1.0", "2.0.0"}
+
+	for i := 0; i < len(ordered)-1; i++ {
+		lower, _ := Parse(ordered[i])
+		higher, _ := Parse(ordered[i+1])
+		if lower.Compare(higher) != -1 || higher.Compare(lower) != 1 {
+			t.Errorf("Expected %s to be lower than %s", ordered[i], ordered[i+1])
+		}
+	}
+
+	a, _ := Parse("v1.2.0")
+	b, _ := Parse("1.2")
+	if a.Compare(b) != 0 {
+		t.Errorf("Expected v1.2.0 and 1.2 to be equal")
+	}
+}
+
+func TestConstraint(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		misses     []string
+	}{
+		{constraint: "^1.2", matches: []string{"1.2.0", "1.9.3"}, misses: []string{"1.1.9", "2.0.0", "1.3.0-rc.1"}},
+		{constraint: "^0.2.3", matches: []string{"0.2.3", "0.2.9"}, misses: []string{"0.3.0", "0.2.2"}},
+		{constraint: "^0.0.3", matches: []string{"0.0.3"}, misses: []string{"0.0.4"}},
+		{constraint: "~1.4.2", matches: []string{"1.4.2", "1.4.9"}, misses: []string{"1.5.0", "1.4.1"}},
+		{constraint: "~1", matches: []string{"1.0.0", "1.9.0"}, misses: []string{"2.0.0"}},
+		{constraint: ">=1.0 <3", matches: []string{"1.0.0", "2.9.9"}, misses: []string{"0.9.0", "3.0.0"}},
+		{constraint: ">= 1.0, < 2", matches: []string{"1.5.0"}, misses: []string{"2.0.0"}},
+		{constraint: ">1.2", matches: []string{"1.3.0"}, misses: []string{"1.2.5"}},
+		{constraint: "<=1.2", matches: []string{"1.2.5"}, misses: []string{"1.3.0"}},
+		{constraint: "1.x", matches: []string{"1.0.0", "1.7.2"}, misses: []string{"2.0.0"}},
+		{constraint: "1.2.x || 3.*", matches: []string{"1.2.4", "3.1.0"}, misses: []string{"1.3.0", "2.0.0"}},
+		{constraint: "*", matches: []string{"0.0.1", "9.9.9"}, misses: []string{"1.0.0-rc.1"}},
+		{constraint: "=2.0.0", matches: []string{"2.0.0"}, misses: []string{"2.0.1"}},
+		{constraint: "^2.0.0-rc.1", matches: []string{"2.0.0-rc.2", "2.0.0", "2.1.0"}, misses: []string{"2.1.0-rc.1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			c, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("Failed to parse constraint: %v", err)
+			}
+			for _, s := range tt.matches {
+				v, _ := Parse(s)
+				if !c.Check(v) {
+					t.Errorf("Expected %s to match %s", s, tt.constraint)
+				}
+			}
+			for _, s := range tt.misses {
+				v, _ := Parse(s)
+				if c.Check(v) {
+					t.Errorf("Expected %s not to match %s", s, tt.constraint)
+				}
+			}
+		})
+	}
+
+	for _, invalid := range []string{"^abc", ">=", "<x", "1.2.3.4"} {
+		if _, err := ParseConstraint(invalid); err == nil {
+			t.Errorf("Expected an error for constraint '%s'", invalid)
+		}
+	}
+}
+
+func TestIsConstraint(t *testing.T) {
+	for _, s := range []string{"^1.2", "~1.0", ">=1.0 <2", "1.x", "1.2.*", "*", "1.0 || 2.0"} {
+		if !IsConstraint(s) {
+			t.Errorf("Expected '%s' to be a constraint", s)
+		}
+	}
+	for _, s := range []string{"", "main", "v1.2.3", "1.2.3", "latest", "0123456789abcdef0123456789abcdef01234567"} {
+		if IsConstraint(s) {
+			t.Errorf("Expected '%s' not to be a constraint", s)
+		}
+	}
+}
+
+func TestHighest(t *testing.T) {
+	tags := []string{"v1.2.0", "v1.3.0", "v1.10.0-rc.1", "v2.0.0", "nightly", "v1.9.1"}
+
+	c, err := ParseConstraint("^1.2")
+	if err != nil {
+		t.Fatalf("Failed to parse constraint: %v", err)
+	}
+	highest := c.Highest(tags)
+	if highest == nil || highest.Original != "v1.9.1" {
+		t.Errorf("Highest matching tag does not match. Expected: %s, Actual: %v", "v1.9.1", highest)
+	}
+
+	latest := Latest(tags)
+	if latest == nil || latest.Original != "v2.0.0" {
+		t.Errorf("Latest tag does not match. Expected: %s, Actual: %v", "v2.0.0", latest)
+	}
+
+	c, _ = ParseConstraint("^3")
+	if v := c.Highest(tags); v != nil {
+		t.Errorf("Expected no matching tag, got %s", v.Original)
+	}
+}